@@ -1,475 +1,344 @@
 package main
 
 import (
-	"bufio"
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"os"
-	"regexp"
-	"sort"
-	"strconv"
+	"path/filepath"
+	"runtime"
 	"strings"
 	"time"
+	"unicode/utf8"
 
-	"github.com/google/uuid"
+	"github.com/jrmycanady/psminimize/psminimize"
 	"github.com/ogier/pflag"
 )
 
 const VERSION = "1.0.1"
 
-const (
-	CHARComment byte = 35
-	ESCChar1    byte = 92
-	ESCChar2    byte = 96
-	LT          byte = 60
-	GT          byte = 62
-)
+// selfTestCommand is the argument running the self test instead of
+// minimizing a script.
+const selfTestCommand = "selftest"
 
 var (
 	cVersion    = pflag.BoolP("version", "v", false, "Show version information")
 	cScriptPath = pflag.StringP("script-path", "s", "", "The path to the PowerShell script file.")
-	cOutputPath = pflag.StringP("output-path", "o", "", "The path to the output file including name.")
+	cOutputPath = pflag.StringP("output-path", "o", "", "The path to the output file including name, or - for stdout.")
+	cZipIn      = pflag.String("zip-in", "", "The path to a zip archive whose scripts are minimized instead of a script file.")
+	cZipOut     = pflag.String("zip-out", "", "The path of the archive written with the minimized scripts when used with --zip-in.")
+	cOnlyFuncs  = pflag.String("only-functions", "", "Comma separated list of functions whose bodies are the only parts minimized.")
+	cDisable    = pflag.String("disable-passes", "", "Comma separated list of passes to skip: comments, variables, spaces, newlines.")
+	cBisect     = pflag.Bool("bisect", false, "Minimize once per pass with that pass disabled and report how each output differs.")
+	cTimes      = pflag.Bool("time-breakdown", false, "Print the time each pass took to stderr.")
+	cProgress   = pflag.Bool("progress", false, "Print the progress of each pass to stderr for scripts over 1MB.")
+	cKeepLines  = pflag.Bool("keep-newlines", false, "Keep every statement on its own line instead of joining them.")
+	cPreserveNL = pflag.Bool("preserve-newlines", false, "Keep every statement on its own line written with the line ending of the script, LF or CRLF.")
+	cReindent   = pflag.Bool("reindent", false, "Keep every statement on its own line indented by two spaces for each level of nesting.")
+	cKeepBlank  = pflag.Bool("keep-blank-lines", false, "Keep a single blank line wherever the script had any when used with --keep-newlines or --reindent.")
+	cJobs       = pflag.Int("jobs", runtime.NumCPU(), "The number of scripts minimized at once when script-path is a directory.")
+	cMaxFiles   = pflag.Int("max-files", 0, "Refuse to minimize a directory holding more scripts than this. 0 is no limit.")
+	cExclude    = pflag.String("exclude", "", "Comma separated list of glob patterns of scripts to skip when script-path is a directory.")
+	cForce      = pflag.Bool("force", false, "Minimize the script even if it appears to have unbalanced quotes or brackets.")
+	cPrepend    = pflag.String("prepend", "", "A file, or if no such file the text itself, to write before the minimized script.")
+	cAppend     = pflag.String("append", "", "A file, or if no such file the text itself, to write after the minimized script.")
+	cMinifyWrap = pflag.Bool("minify-wrappers", false, "Minimize the prepended and appended content too, without renaming variables.")
+	cFinalLine  = pflag.Bool("final-newline", true, "End the output with exactly one new line, or none when false.")
+	cReserved   = pflag.String("reserved", "", "Comma separated list of variables, such as $Path, whose names are kept.")
+	cReservedCS = pflag.Bool("reserved-case-sensitive", false, "Match the names given to --reserved only against variables spelled with the same case.")
+	cListRes    = pflag.Bool("list-reserved", false, "Print the variables that are never renamed and exit.")
+	cCode       = pflag.String("code", "", "Minimize this script text instead of a file and print the result.")
+	cBlankOnly  = pflag.Bool("strip-blank-lines-only", false, "Only remove empty lines, leaving the script otherwise untouched.")
+	cKeepStruct = pflag.Int("keep-structure", 0, "Keep statements nested within fewer than this many braces on their own lines.")
+	cPublicHelp = pflag.Bool("keep-public-help", false, "Keep the comment based help of exported functions.")
+	cSaveComms  = pflag.Bool("save-comments", false, "Save the stripped comments beside the output with their original line numbers.")
+	cTarget     = pflag.Int("target-bytes", 0, "Minimize only the largest functions needed to get the output under this size.")
+	cDotSource  = pflag.Bool("resolve-dot-source", false, "Keep the names of variables shared with dot-sourced scripts.")
+	cFirstLine  = pflag.Bool("preserve-first-line", false, "Write the first line as it is, minimizing only the rest.")
+	cPartial    = pflag.Bool("allow-partial", false, "Write what can be minimized safely with a warning instead of failing.")
+	cKeepSpace  = pflag.String("keep-spacing-around", "", "Comma separated list of operators to keep the spaces around.")
+	cMinus      = pflag.Bool("collapse-minus", false, "Remove the space after a - too, which can change how arguments to commands are parsed.")
+	cMetrics    = pflag.String("metrics-format", "", "Print the statistics of a single script as json or prometheus.")
+	cNoGrow     = pflag.Bool("no-grow", false, "Write the original script instead of a minimized one that is larger.")
+	cDryRun     = pflag.BoolP("dry-run", "n", false, "Minimize and report the savings without writing any output.")
+	cPreview    = pflag.Int("preview", 0, "Print the first this many bytes of the output to stderr as well.")
+	cNoRename   = pflag.BoolP("no-rename", "R", false, "Keep every variable name as it is, the same as disabling the variables pass.")
+	cReportMD   = pflag.String("report-md", "", "Write a Markdown report of the sizes, renamed variables and warnings to this path.")
+	cEOL        = pflag.String("normalize-eol", "", "Only rewrite every line ending as lf or crlf, leaving the script otherwise untouched.")
+	cMinCount   = pflag.Int("min-var-count", 0, "Only rename variables used at least this many times.")
+	cNamePrefix = pflag.String("name-prefix", "", "Start every new variable name with this prefix.")
+	cVerbosity  = pflag.Int("verbose-level", psminimize.LogSummary, "Diagnostics to print: 0 none, 1 summary, 2 per pass savings, 3 variable names, 4 line decisions.")
 )
 
-var (
-	varShortNames = []byte{65, 66, 67, 68, 69, 70, 71, 72, 73, 74, 75, 76, 77, 78, 79, 80, 81, 82, 83, 84, 85, 86, 87, 88, 89, 90, 97, 98, 99, 100, 101, 102, 103, 104, 105, 106, 107, 108, 109, 110, 111, 112, 113, 114, 115, 116, 117, 118, 119, 120, 121}
-)
-
-// PSVariable represents a variable found in the PowerShell file.
-type PSVariable struct {
-	OriginalName string
-	UniqueName   string
-	ShortName    string
-	Count        int
-	Reserved     bool
-	SourceLine   string
+// exitWithError prints err to stderr and exits with a non-zero status.
+func exitWithError(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
 }
 
-// PSVariables represents a slice of PSVariable structs that can be
-// sorted.
-type PSVariables []PSVariable
-
-func (p PSVariables) Len() int           { return len(p) }
-func (p PSVariables) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
-func (p PSVariables) Less(i, j int) bool { return p[i].Count > p[j].Count }
-
-// assignUniqueRandomNames assigns a unique random name to every variable.
-func (p PSVariables) assignUniqueRandomNames() {
-	for i := range p {
-		id, err := uuid.NewRandom()
-		panicOnErr(err)
-		p[i].UniqueName = fmt.Sprintf("$~~%s", strings.ToUpper(id.String()))
-	}
-	sort.Sort(PSVariablesNameMod(p))
-}
+func main() {
+	pflag.Parse()
 
-// replaceVariablesWithUnique replaces all the variables with their unique
-// name.
-func (p PSVariables) replaceVariablesWithUnique(lines []string) {
-	sort.Sort(PSVariablesNameMod(p))
-	for i := range lines {
-		lines[i] = strings.ToUpper(lines[i])
-		for j := 0; j < len(p); j++ {
-			// fmt.Println(lines[i])
-			lines[i] = strings.Replace(lines[i], p[j].OriginalName, p[j].UniqueName, -1)
-			// fmt.Println(lines[i])
+	if pflag.Arg(0) == selfTestCommand {
+		if !psminimize.RunSelfTest(os.Stdout) {
+			os.Exit(1)
 		}
+		return
 	}
-}
 
-// replaceUniqueWithShort replaces all unique variables with the short version.
-func (p PSVariables) replaceUniqueWithShort(lines []string) {
-	sort.Sort(PSVariablesNameMod(p))
-	for i := range lines {
-		for j := range p {
-			// fmt.Println(lines[i])
-			lines[i] = strings.Replace(lines[i], p[j].UniqueName, p[j].ShortName, -1)
-			// fmt.Println(lines[i])
-		}
+	if *cVersion {
+		fmt.Printf("psminimize version %s\n", VERSION)
+		return
 	}
-}
 
-// Sort sorts the PSVariable by count.
-func (p PSVariables) Sort() {
-	sort.Sort(p)
-}
-
-// generateShortNames generates short names for all variables making sure
-// the more used variables have the shortest name.
-func (p PSVariables) generateShortNames() {
+	if *cListRes {
+		psminimize.ListReserved(os.Stdout)
+		return
+	}
 
-	var count int
-	var nameIter int
-	for i := 0; i < len(p); i++ {
-		if p[i].Reserved {
-			continue
-		}
-		s := "$" + string(varShortNames[nameIter-(51*count)])
-		if count > 0 {
-			s = s + strconv.Itoa(count-1)
-		}
+	if *cZipIn != "" && *cZipOut == "" {
+		exitWithError(errors.New("no output archive provided"))
+	}
+	if *cScriptPath == "" && *cCode == "" && *cZipIn == "" && !stdinPiped() {
+		exitWithError(errors.New("no file provided"))
+	}
+	if psminimize.IsStdout(*cOutputPath) && (*cBisect || (*cSaveComms && !*cDryRun)) {
+		exitWithError(errors.New("no output file provided"))
+	}
 
-		p[i].ShortName = s
+	var minimizedLines []string
+	var start = time.Now()
 
-		if ((nameIter + 1) % 51) == 0 {
-			count++
+	var opts psminimize.Options
+	var err error
+	opts.Log = psminimize.NewLogger(os.Stderr, *cVerbosity)
+	opts.Force = *cForce
+	opts.AllowPartial = *cPartial
+	opts.NoFinalNewline = !*cFinalLine
+	opts.KeepNewlines = *cKeepLines
+	opts.KeepBlankLines = *cKeepBlank
+	opts.PreserveNewlines = *cPreserveNL
+	opts.Reindent = *cReindent
+	opts.PreserveFirstLine = *cFirstLine
+	opts.ResolveDotSource = *cDotSource
+	opts.TargetBytes = *cTarget
+	opts.NamePrefix = *cNamePrefix
+	opts.MinVarCount = *cMinCount
+	opts.CollapseMinus = *cMinus
+	opts.SaveComments = *cSaveComms
+	opts.DryRun = *cDryRun
+	opts.NoGrow = *cNoGrow
+	opts.KeepPublicHelp = *cPublicHelp
+	opts.KeepStructure = *cKeepStruct
+	opts.BlankLinesOnly = *cBlankOnly
+	if *cMetrics != "" && !psminimize.ValidMetricsFormat(*cMetrics) {
+		exitWithError(fmt.Errorf("unknown metrics format: %s", *cMetrics))
+	}
+	if *cEOL != "" {
+		opts.NormalizeEOL, err = psminimize.ParseLineEnding(*cEOL)
+		if err != nil {
+			exitWithError(err)
 		}
-		nameIter++
 	}
-}
-
-// shortenVariables shorts all variables found in lines.
-func (p PSVariables) shortenVariables(lines []string) {
-	// p.print()
-	p.assignUniqueRandomNames()
-	// p.print()
-	p.generateShortNames()
-	// p.print()
-	p.replaceVariablesWithUnique(lines)
-	p.replaceUniqueWithShort(lines)
-}
-
-func (p PSVariables) print() {
-	for i := range p {
-
-		fmt.Printf("%s => %s => %s\n", p[i].OriginalName, p[i].UniqueName, p[i].ShortName)
-		fmt.Printf("   |%s\n", p[i].SourceLine)
+	if *cReportMD != "" {
+		opts.Report = &psminimize.Report{}
 	}
-}
-
-// PSVariablesNameMod allows sorting based on original name length.
-type PSVariablesNameMod PSVariables
-
-func (p PSVariablesNameMod) Len() int      { return len(p) }
-func (p PSVariablesNameMod) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
-func (p PSVariablesNameMod) Less(i, j int) bool {
-	return len(p[i].OriginalName) > len(p[j].OriginalName)
-}
-
-// panicOnErr checks if e is nil and if not panics.
-func panicOnErr(e error) {
-	if e != nil {
-		panic(e)
+	if !psminimize.ValidNamePrefix(opts.NamePrefix) {
+		exitWithError(fmt.Errorf("invalid name prefix: %s", opts.NamePrefix))
 	}
-}
-
-func main() {
-	pflag.Parse()
-
-	if *cVersion {
-		fmt.Printf("psminimize version %s\n", VERSION)
-		return
+	if *cOnlyFuncs != "" {
+		opts.OnlyFunctions = strings.Split(*cOnlyFuncs, ",")
 	}
-
-	if *cScriptPath == "" {
-		fmt.Println("no file provided")
-		return
+	if *cReserved != "" {
+		opts.ReservedNames = strings.Split(*cReserved, ",")
 	}
-	if *cOutputPath == "" {
-		fmt.Println("no output file provided")
-		return
+	opts.ReservedCaseSensitive = *cReservedCS
+	opts.Disabled, err = psminimize.ParsePassNames(*cDisable)
+	if err != nil {
+		exitWithError(err)
 	}
-
-	var minimizedLines = make([]string, 0, 20)
-	var originalLines = make([]string, 0, 0)
-	var start = time.Now()
-
-	// Reading the file into the original array and duplicate for minimized.
-	f, err := os.Open(*cScriptPath)
-	panicOnErr(err)
-	defer f.Close()
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		originalLines = append(originalLines, scanner.Text())
+	if *cNoRename {
+		opts.Disabled["variables"] = true
 	}
-	minimizedLines = make([]string, len(originalLines), len(originalLines))
-	copy(minimizedLines, originalLines)
-
-	stripAllComments(minimizedLines)
-
-	shortenAllVariableNames(minimizedLines)
-
-	removeExtraSpaces(minimizedLines)
-
-	minimizedLines = removeAllNewLines(minimizedLines)
-
-	//printComparison(originalLines, minimizedLines)
-
-	saveToFile(minimizedLines, *cOutputPath)
-
-	// fmt.Printf("minimization completed in %d seconds and reduced by %f %d -> %d = %f\n", getLength(originalLines), getLength(minimizedLines), (float64(getLength(minimizedLines)) / float64(getLength(originalLines)) * 100))
-	fmt.Printf("minimization completed in %f seconds and reduced by %f%%\n", time.Since(start).Seconds(), (100 - (float64(getLength(minimizedLines)) / float64(getLength(originalLines)) * 100)))
-}
-
-func getLength(lines []string) int {
-	l := 0
-	for i := range lines {
-		l += len(lines[i])
+	opts.KeepSpacing, err = psminimize.ParseSpacingOperators(*cKeepSpace)
+	if err != nil {
+		exitWithError(err)
 	}
-
-	return l
-}
-
-func saveToFile(lines []string, filePath string) {
-	fmt.Printf("saving to: %s\n", filePath)
-
-	f, err := os.Create(filePath)
-	panicOnErr(err)
-
-	for i := range lines {
-		_, err := f.WriteString(lines[i])
-		panicOnErr(err)
+	opts.Header, err = psminimize.LoadWrapper(*cPrepend, *cMinifyWrap)
+	if err != nil {
+		exitWithError(err)
 	}
-}
-
-func printComparison(original []string, minimized []string) {
-	for i := 0; i < len(original); i++ {
-		if len(minimized) > i {
-			fmt.Printf("%-120s | %s\n", original[i], minimized[i])
-		} else {
-			fmt.Printf("%-120s |\n", original[i])
-		}
-
+	opts.Footer, err = psminimize.LoadWrapper(*cAppend, *cMinifyWrap)
+	if err != nil {
+		exitWithError(err)
 	}
-}
 
-// stripAllComments strips any comments form all lines in the slice and
-// stores the result back into place.
-func stripAllComments(lines []string) {
-	var multi bool
-	for i := range lines {
-		lines[i], multi = stripComments(lines[i], multi)
+	// The times are added up over every script minimized and printed once
+	// all are done.
+	var times psminimize.PassTimes
+	if *cTimes {
+		opts.Timing = times.Add
+		defer func() { fmt.Fprintln(os.Stderr, times.String()) }()
 	}
-}
-
-// stripComments removes any comments from the line and returns the line
-// with the comments stripped. If a multi line comment was started but not
-// finished the bool return value will be true.
-func stripComments(line string, multi bool) (string, bool) {
-	minLine := make([]byte, 0, len(line))
 
-	// Processing obvious ignorable lines returning an empty line in
-	// its place.
-	switch {
-	case len(line) <= 0:
-		return "", multi
-	case line[0] == CHARComment:
-		return "", multi
+	if *cZipIn != "" {
+		exclude, err := psminimize.ParseExcludePatterns(*cExclude)
+		if err != nil {
+			exitWithError(err)
+		}
+		if err := psminimize.MinimizeZip(*cZipIn, *cZipOut, opts, exclude); err != nil {
+			exitWithError(err)
+		}
+		return
 	}
 
-	// Processing each character looking for a start or stop of a comment
-	// depending on the value of mutli.
-	for i := 0; i < len(line); i++ {
-		if multi {
-			// A multi line comment has continued so looking for the end
-			// comment character. If found looking forward one (if possible)
-			// and if it's > closing the comment. In all cases no characters
-			// are saved as we are in a multi line comment.
-			if line[i] == CHARComment {
-				if len(line) >= i && line[i+1] == GT {
-					i++
-					multi = false
-				}
+	var originalLines []string
+	var originalLength int
+	if *cCode != "" {
+		// Script text given on the command line is minimized as if it was
+		// read from a file.
+		originalLines = strings.Split(strings.Replace(*cCode, "\r\n", "\n", -1), "\n")
+		originalLength = len(*cCode)
+		if opts.PreserveNewlines {
+			opts.LineEnding = psminimize.DetectLineEnding([]byte(*cCode))
+		}
+	} else if *cScriptPath == "" {
+		// Without a path the script is read from whatever is piped in. It is
+		// read whole first so its line ending can be found.
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			exitWithError(err)
+		}
+		originalLines, err = psminimize.ReadLinesFrom(bytes.NewReader(data))
+		if err != nil {
+			exitWithError(err)
+		}
+		originalLength = len(data)
+		if opts.PreserveNewlines {
+			opts.LineEnding = psminimize.DetectLineEnding(data)
+		}
+	} else {
+		// A directory minimizes every script within it into the output
+		// directory.
+		if info, err := os.Stat(*cScriptPath); err == nil && info.IsDir() {
+			if psminimize.IsStdout(*cOutputPath) && !opts.DryRun {
+				exitWithError(errors.New("no output directory provided"))
 			}
-		} else {
-			if line[i] == CHARComment {
-				// Ruling out escaped comment character.
-				if len(line) >= i && (line[i-1] == ESCChar1 || line[i-1] == ESCChar2) {
-					minLine = append(minLine, line[i])
-					continue
-				}
-
-				// Ruling out that it's not a start of a multiline.
-				if len(line) >= i && (line[i-1] == LT) {
-					multi = true
-					// remove the start character found
-					minLine = minLine[:len(minLine)-1]
-					continue
-				}
-
-				// Appears to be a comment so ignore from here on.
-				break
-			} else {
-				// Appears to be a valid character so add.
-				minLine = append(minLine, line[i])
+			exclude, err := psminimize.ParseExcludePatterns(*cExclude)
+			if err != nil {
+				exitWithError(err)
 			}
+			if err := psminimize.MinimizeBatch(*cScriptPath, *cOutputPath, opts, *cJobs, *cMaxFiles, exclude); err != nil {
+				exitWithError(err)
+			}
+			return
 		}
-	}
-
-	return string(minLine), multi
-}
-
-// shortenAllVariableNames shortens all the variable names to the minimum
-// characters possible.
-func shortenAllVariableNames(lines []string) {
-	// Retrieving all variables and their counts.
-	psVars := getVariables(lines)
-	psVars.shortenVariables(lines)
-}
 
-// getVariables retrieves all the variables found in lines along with the
-// count.
-func getVariables(lines []string) PSVariables {
-	var psVars PSVariables
-	var psVarMap = make(map[string]int)
-	var psVarReg = regexp.MustCompile("[`]?\\$[A-Z0-9a-z_]*")
-	var psVarSource = make(map[string]string)
-
-	for i := range lines {
-		r := psVarReg.FindAllStringSubmatch(lines[i], -1)
-		if r == nil {
-			continue
+		// Reading the file into the original array and duplicate for minimized.
+		originalLines, originalLength, err = psminimize.ReadLines(*cScriptPath)
+		if err != nil {
+			exitWithError(err)
+		}
+		opts = psminimize.DataFileOptions(*cScriptPath, opts)
+		if opts.PreserveNewlines {
+			opts.LineEnding, err = psminimize.ReadLineEnding(*cScriptPath)
+			if err != nil {
+				exitWithError(err)
+			}
 		}
 
-		for j := range r {
-			for m := range r[j] {
-				varName := strings.ToUpper(r[j][m])
-				psVarMap[varName]++
-				if psVarMap[varName] == 1 {
-					psVarSource[varName] = lines[i]
-				}
+		if opts.ResolveDotSource {
+			shared, err := psminimize.DotSourceReserved([]string{*cScriptPath}, opts.Log)
+			if err != nil {
+				exitWithError(err)
 			}
+			opts = psminimize.WithReserved(opts, shared[filepath.Clean(*cScriptPath)])
 		}
 	}
-	for k, v := range psVarMap {
-		p := PSVariable{OriginalName: k, Count: v, SourceLine: psVarSource[k]}
-		// Adding any reserved.
-		_, ok := reservedPSVariables[k]
-		if ok {
-			p.Reserved = true
-			p.ShortName = p.OriginalName
-		}
 
-		// Making sure we don't replace any escaped sequencing by marking as
-		// reserved.
-		if string(k[0]) == "`" {
-			p.Reserved = true
-			p.ShortName = p.OriginalName
-		}
+	if *cProgress && psminimize.GetLength(originalLines) >= psminimize.ProgressMinBytes {
+		opts.Progress = psminimize.PrintProgress()
+	}
 
-		// Ignore empty $ as it's likely a $($var).
-		if k == "$" {
-			continue
+	if *cBisect {
+		if err := psminimize.BisectPasses(originalLines, opts, *cOutputPath, os.Stdout); err != nil {
+			exitWithError(err)
 		}
-
-		psVars = append(psVars, p)
+		return
 	}
 
-	sort.Sort(PSVariablesNameMod(psVars))
-
-	return psVars
-}
-
-// getNextShortname returns the next shortname to use. Use 0 for the first call.
-func getNextShortName(lastName byte) byte {
-	if lastName == 0 {
-		return 65
+	minimizedLines, err = psminimize.Minimize(originalLines, opts)
+	if err != nil {
+		exitWithError(err)
 	}
 
-	// Get the next character.
-	lastName++
+	//printComparison(originalLines, minimizedLines)
 
-	// Skip special characters
-	if lastName == 91 {
-		return 97
+	output := psminimize.FinishOutput(psminimize.GuardGrowth(originalLines, minimizedLines, opts), opts)
+	if *cPreview > 0 {
+		fmt.Fprintf(os.Stderr, "%s\n", preview(strings.Join(output, ""), *cPreview))
 	}
-
-	if lastName > 172 {
-
+	if opts.DryRun {
+		opts.Log(psminimize.LogSummary, "%d -> %d bytes, not written", originalLength, psminimize.GetLength(output))
+	} else if err := psminimize.SaveToFile(output, *cOutputPath, opts.Log); err != nil {
+		exitWithError(err)
 	}
-
-	return lastName
-
-}
-
-// removeExtraSpaces removes any extra spaces around various powershell
-// operators.
-func removeExtraSpaces(lines []string) {
-	for i := range lines {
-		// fmt.Println(lines[i])
-		lines[i] = strings.Replace(lines[i], " =", "=", -1)
-		// fmt.Println(lines[i])
-		lines[i] = strings.Replace(lines[i], "= ", "=", -1)
-		lines[i] = strings.Replace(lines[i], " +", "+", -1)
-		lines[i] = strings.Replace(lines[i], "+ ", "+", -1)
-		//lines[i] = strings.Replace(lines[i], " - ", "-", -1)
-		lines[i] = strings.Replace(lines[i], "- ", "-", -1)
-		lines[i] = strings.Replace(lines[i], " *", "*", -1)
-		lines[i] = strings.Replace(lines[i], "* ", "*", -1)
-		lines[i] = strings.Replace(lines[i], " -EQ", "-EQ", -1)
-		lines[i] = strings.Replace(lines[i], "-EQ ", "-EQ", -1)
-		lines[i] = strings.Replace(lines[i], " -GT", "-GT", -1)
-		lines[i] = strings.Replace(lines[i], "-GT ", "-GT", -1)
-		lines[i] = strings.Replace(lines[i], " -LT", "-LT", -1)
-		lines[i] = strings.Replace(lines[i], "-LT ", "-LT", -1)
-		lines[i] = strings.Replace(lines[i], " -NE", "-NE", -1)
-		lines[i] = strings.Replace(lines[i], "-NE ", "-NE", -1)
-		lines[i] = strings.Replace(lines[i], " -LE", "-LE", -1)
-		lines[i] = strings.Replace(lines[i], "-LE ", "-LE", -1)
-		lines[i] = strings.Replace(lines[i], " -GE", "-GE", -1)
-		lines[i] = strings.Replace(lines[i], "-GE ", "-GE", -1)
-		lines[i] = strings.Replace(lines[i], " /", "/", -1)
-		lines[i] = strings.Replace(lines[i], "/ ", "/", -1)
-
-		lines[i] = strings.Replace(lines[i], "( ", "(", -1)
-		lines[i] = strings.Replace(lines[i], " (", "(", -1)
-		lines[i] = strings.Replace(lines[i], " )", ")", -1)
-		lines[i] = strings.Replace(lines[i], ") ", ")", -1)
-
-		lines[i] = strings.Replace(lines[i], "[ ", "[", -1)
-		lines[i] = strings.Replace(lines[i], " [", "[", -1)
-		lines[i] = strings.Replace(lines[i], " ]", "]", -1)
-		lines[i] = strings.Replace(lines[i], "] ", "]", -1)
-
-		lines[i] = strings.Replace(lines[i], "{ ", "{", -1)
-		lines[i] = strings.Replace(lines[i], " {", "{", -1)
-		lines[i] = strings.Replace(lines[i], " }", "}", -1)
-		lines[i] = strings.Replace(lines[i], "} ", "}", -1)
-
-		lines[i] = strings.Replace(lines[i], "; ", ";", -1)
-		lines[i] = strings.Replace(lines[i], " ;", ";", -1)
+	if opts.SaveComments && !opts.DryRun {
+		if err := psminimize.SaveComments(psminimize.CollectComments(originalLines), *cOutputPath+psminimize.CommentsExt, opts.Log); err != nil {
+			exitWithError(err)
+		}
 	}
-}
 
-// removeAllNewLines removes all new lines that adding semicolons as needed.
-func removeAllNewLines(lines []string) []string {
-	minimizedLines := make([]string, 0, len(lines))
+	// fmt.Printf("minimization completed in %d seconds and reduced by %f %d -> %d = %f\n", getLength(originalLines), getLength(minimizedLines), (float64(getLength(minimizedLines)) / float64(getLength(originalLines)) * 100))
+	opts.Log(psminimize.LogSummary, "minimization completed in %f seconds and reduced by %f%%", time.Since(start).Seconds(), psminimize.PercentReduced(originalLength, psminimize.GetLength(output)))
 
-	for i := range lines {
-		l := strings.TrimSpace(lines[i])
-		l = strings.TrimSuffix(l, "\n")
-		l = strings.TrimSuffix(l, "\r")
+	metrics := psminimize.Metrics{OriginalBytes: originalLength, MinimizedBytes: psminimize.GetLength(output), Duration: time.Since(start)}
 
-		// skip empty lines
-		if l == "" {
-			continue
+	// The metrics go to stderr when stdout already holds the script.
+	if *cMetrics != "" {
+		w := os.Stdout
+		if psminimize.IsStdout(*cOutputPath) {
+			w = os.Stderr
+		}
+		if err := psminimize.WriteMetrics(w, *cMetrics, metrics); err != nil {
+			exitWithError(err)
 		}
+	}
+	if opts.Report != nil {
+		opts.Report.Metrics = metrics
+		opts.Report.Comments = len(psminimize.CollectComments(originalLines))
+		if err := opts.Report.SaveMarkdown(*cReportMD, opts.Log); err != nil {
+			exitWithError(err)
+		}
+	}
+}
 
-		switch l[len(l)-1:] {
-		// switch lines[i][len(lines[i])-1:] {
-		case "{", "(", ";":
+// preview returns up to the first n bytes of s, cut short if need be so it
+// does not end part way through a character.
+func preview(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
 
-		case "]":
-			l = l + "\n"
-		case ",":
-			// nothing is needed for these.
-		case "M":
-			// Could be a param, check it out.
-			if len(l) >= 5 {
-				if l[len(l)-5:] == "PARAM" {
-					minimizedLines = append(minimizedLines, l)
+// stdinPiped returns true if stdin is a pipe or file rather than a terminal.
+func stdinPiped() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice == 0
+}
 
-					continue
-				}
-			} else {
-				l = l + ";"
-			}
-		default:
-			l = l + ";"
+func printComparison(original []string, minimized []string) {
+	for i := 0; i < len(original); i++ {
+		if len(minimized) > i {
+			fmt.Printf("%-120s | %s\n", original[i], minimized[i])
+		} else {
+			fmt.Printf("%-120s |\n", original[i])
 		}
-		minimizedLines = append(minimizedLines, l)
 
 	}
-
-	return minimizedLines
-
 }
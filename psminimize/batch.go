@@ -0,0 +1,212 @@
+package psminimize
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// batchResult holds the outcome of minimizing a single script in batch mode.
+type batchResult struct {
+	OriginalLength  int
+	MinimizedLength int
+	Log             []logEntry
+	Err             error
+}
+
+// logEntry is a diagnostic held back to be logged later.
+type logEntry struct {
+	Level int
+	Msg   string
+}
+
+// ParseExcludePatterns parses the comma separated list of glob patterns
+// matching the scripts to skip, returning an error if any is malformed.
+func ParseExcludePatterns(list string) ([]string, error) {
+	var patterns []string
+	for _, p := range strings.Split(list, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, newError(ErrBadPattern, "invalid exclude pattern %s", p)
+		}
+		patterns = append(patterns, p)
+	}
+
+	return patterns, nil
+}
+
+// excluded returns true if the script at rel, relative to the directory
+// being minimized, matches any of patterns ignoring case. A pattern matches
+// either the file name or the whole relative path.
+func excluded(patterns []string, rel string) bool {
+	rel = strings.ToLower(filepath.ToSlash(rel))
+	for _, p := range patterns {
+		p = strings.ToLower(p)
+		if ok, _ := path.Match(p, path.Base(rel)); ok {
+			return true
+		}
+		if ok, _ := path.Match(p, rel); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// isScript returns true if name is a PowerShell script, module or data file.
+func isScript(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".ps1", ".psm1", ".psd1":
+		return true
+	}
+	return false
+}
+
+// findScripts returns the paths of every PowerShell script and data file
+// within dir relative to it in lexical order, skipping any matching one of
+// exclude.
+func findScripts(dir string, exclude []string) ([]string, error) {
+	var paths []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		if isScript(path) {
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+			if !excluded(exclude, rel) {
+				paths = append(paths, rel)
+			}
+		}
+		return nil
+	})
+
+	return paths, err
+}
+
+// MinimizeBatch minimizes every script within inDir into the same relative
+// path within outDir using up to jobs workers at once, skipping any script
+// matching one of exclude. Each script's diagnostics are held back and
+// logged in path order once all are done so the output is the same no
+// matter how the work was scheduled.
+func MinimizeBatch(inDir string, outDir string, opts Options, jobs int, maxFiles int, exclude []string) error {
+	paths, err := findScripts(inDir, exclude)
+	if err != nil {
+		return err
+	}
+	if maxFiles > 0 && len(paths) > maxFiles {
+		return newError(ErrTooManyFiles, "%s holds %d scripts which is more than the maximum of %d", inDir, len(paths), maxFiles)
+	}
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	var shared map[string]map[string]string
+	if opts.ResolveDotSource {
+		full := make([]string, len(paths))
+		for i := range paths {
+			full[i] = filepath.Join(inDir, paths[i])
+		}
+		if shared, err = DotSourceReserved(full, opts.Log); err != nil {
+			return err
+		}
+	}
+
+	results := make([]batchResult, len(paths))
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				i := i
+				fileOpts := WithReserved(opts, shared[filepath.Join(inDir, paths[i])])
+				fileOpts.Progress = nil
+				fileOpts.Log = func(level int, format string, args ...interface{}) {
+					results[i].Log = append(results[i].Log, logEntry{level, fmt.Sprintf(format, args...)})
+				}
+				results[i].OriginalLength, results[i].MinimizedLength, results[i].Err = minimizeFile(filepath.Join(inDir, paths[i]), filepath.Join(outDir, paths[i]), fileOpts)
+			}
+		}()
+	}
+	for i := range paths {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+
+	var failed int
+	var originalLength, minimizedLength int
+	for i := range results {
+		for _, e := range results[i].Log {
+			opts.Log.logf(e.Level, "%s", e.Msg)
+		}
+		if results[i].Err != nil {
+			failed++
+			opts.Log.logf(LogSummary, "%s: %s", paths[i], results[i].Err)
+			continue
+		}
+		originalLength += results[i].OriginalLength
+		minimizedLength += results[i].MinimizedLength
+	}
+
+	opts.Log.logf(LogSummary, "minimized %d of %d scripts reducing them by %f%%", len(paths)-failed, len(paths), PercentReduced(originalLength, minimizedLength))
+	if failed > 0 {
+		return newError(ErrScriptsFailed, "%d %s", failed, ErrScriptsFailed)
+	}
+
+	return nil
+}
+
+// minimizeFile minimizes the script at inPath into outPath creating any
+// missing directories, returning the bytes read and the bytes written. With
+// opts.DryRun set nothing is written and the bytes that would have been are
+// returned.
+func minimizeFile(inPath string, outPath string, opts Options) (int, int, error) {
+	lines, length, err := ReadLines(inPath)
+	if err != nil {
+		return 0, 0, err
+	}
+	opts = DataFileOptions(inPath, opts)
+	if opts.PreserveNewlines {
+		if opts.LineEnding, err = ReadLineEnding(inPath); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	minimizedLines, err := Minimize(lines, opts)
+	if err != nil {
+		return 0, 0, err
+	}
+	output := FinishOutput(GuardGrowth(lines, minimizedLines, opts), opts)
+	if opts.DryRun {
+		opts.Log.logf(LogSummary, "%s: %d -> %d bytes, not written", inPath, length, GetLength(output))
+		return length, GetLength(output), nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(outPath), 0755); err != nil {
+		return 0, 0, err
+	}
+	if err := SaveToFile(output, outPath, opts.Log); err != nil {
+		return 0, 0, err
+	}
+	if opts.SaveComments {
+		if err := SaveComments(CollectComments(lines), outPath+CommentsExt, opts.Log); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	return length, GetLength(output), nil
+}
@@ -0,0 +1,92 @@
+package psminimize
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeScripts writes each script of files, keyed by its path relative to
+// dir, creating any missing directories.
+func writeScripts(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for rel, script := range files {
+		path := filepath.Join(dir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(script), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// readScript returns the content of the file at rel within dir.
+func readScript(t *testing.T, dir string, rel string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(rel)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestMinimizeBatchManyFiles(t *testing.T) {
+	inDir, outDir := t.TempDir(), t.TempDir()
+	files := make(map[string]string)
+	for i := 0; i < 200; i++ {
+		files[fmt.Sprintf("dir%d/script%d.ps1", i%7, i)] = fmt.Sprintf("$value = %d\n$value + $value\n", i)
+	}
+	writeScripts(t, inDir, files)
+
+	if err := MinimizeBatch(inDir, outDir, Options{}, 8, 0, nil); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 200; i++ {
+		rel := fmt.Sprintf("dir%d/script%d.ps1", i%7, i)
+		if got, want := readScript(t, outDir, rel), fmt.Sprintf("$A=%d;$A+$A;\n", i); got != want {
+			t.Errorf("%s: got %q, want %q", rel, got, want)
+		}
+	}
+
+	err := MinimizeBatch(inDir, t.TempDir(), Options{}, 8, 199, nil)
+	if !errors.Is(err, ErrTooManyFiles) {
+		t.Errorf("expected %q, got %v", ErrTooManyFiles, err)
+	}
+}
+
+func TestMinimizeBatchDryRun(t *testing.T) {
+	inDir, outDir := t.TempDir(), t.TempDir()
+	writeScripts(t, inDir, map[string]string{
+		"a.ps1":     "$value = 1\n$value\n",
+		"sub/b.ps1": "$value = 2\n$value\n",
+	})
+
+	var logged []string
+	opts := Options{DryRun: true, SaveComments: true, Log: func(level int, format string, args ...interface{}) {
+		logged = append(logged, fmt.Sprintf(format, args...))
+	}}
+	if err := MinimizeBatch(inDir, outDir, opts, 2, 0, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := os.ReadDir(outDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("expected nothing written, got %d entries", len(entries))
+	}
+	var reported int
+	for _, msg := range logged {
+		if strings.HasSuffix(msg, "bytes, not written") {
+			reported++
+		}
+	}
+	if reported != 2 {
+		t.Errorf("expected the savings of both scripts to be logged, got %q", logged)
+	}
+}
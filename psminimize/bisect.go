@@ -0,0 +1,90 @@
+package psminimize
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// BisectPasses minimizes lines once with every pass enabled and then once per
+// pass with only that pass disabled. Each variant is saved beside
+// outputPath and reported to w with how it differs from the full output so a
+// broken pass can be found by testing the variants.
+func BisectPasses(lines []string, opts Options, outputPath string, w io.Writer) error {
+	full, err := Minimize(lines, opts)
+	if err != nil {
+		return err
+	}
+	fullText := strings.Join(full, "")
+	if err := SaveToFile(full, outputPath, opts.Log); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "all passes: %d bytes\n", len(fullText))
+
+	ext := filepath.Ext(outputPath)
+	for i := range passes {
+		if opts.Disabled[passes[i].Name] {
+			continue
+		}
+
+		variantOpts := opts
+		variantOpts.Disabled = map[string]bool{passes[i].Name: true}
+		for k, v := range opts.Disabled {
+			variantOpts.Disabled[k] = v
+		}
+
+		variant, err := Minimize(lines, variantOpts)
+		if err != nil {
+			return err
+		}
+		variantText := strings.Join(variant, "")
+
+		d := firstDifference(fullText, variantText)
+		if d < 0 {
+			fmt.Fprintf(w, "without %s: identical output\n", passes[i].Name)
+			continue
+		}
+
+		variantPath := strings.TrimSuffix(outputPath, ext) + ".no-" + passes[i].Name + ext
+		if err := SaveToFile(variant, variantPath, opts.Log); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "without %s: %d bytes, first difference at byte %d\n", passes[i].Name, len(variantText), d)
+		fmt.Fprintf(w, "   all passes |%s\n", excerpt(fullText, d))
+		fmt.Fprintf(w, "   without    |%s\n", excerpt(variantText, d))
+	}
+
+	return nil
+}
+
+// firstDifference returns the index of the first byte that differs between
+// a and b or -1 if they are identical.
+func firstDifference(a string, b string) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	if len(a) != len(b) {
+		if len(a) < len(b) {
+			return len(a)
+		}
+		return len(b)
+	}
+
+	return -1
+}
+
+// excerpt returns up to 60 characters of s starting at i on a single line.
+func excerpt(s string, i int) string {
+	if i > len(s) {
+		i = len(s)
+	}
+	end := i + 60
+	if end > len(s) {
+		end = len(s)
+	}
+
+	return strings.Replace(s[i:end], "\n", "\\n", -1)
+}
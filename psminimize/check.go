@@ -0,0 +1,58 @@
+package psminimize
+
+// checkBalance returns an error describing the first string, comment,
+// bracket, brace or parenthesis in lines that is left unbalanced. Scripts
+// that are already malformed can not be minimized reliably. Line numbers
+// are reported as if offset lines came before lines.
+func checkBalance(lines []string, offset int) error {
+	var state lexState
+	for i := range lines {
+		state.scan(lines[i])
+		if state.unexpected != 0 {
+			return newError(ErrUnbalancedBraces, "input appears malformed: unexpected %c on line %d", state.unexpected, offset+i+1)
+		}
+	}
+
+	// A string left open is reported before the brackets it is within as
+	// those are only left open by it.
+	switch {
+	case state.here != 0:
+		return newError(ErrUnterminatedString, "input appears malformed: unterminated here-string")
+	case state.comment:
+		return newError(ErrMalformedInput, "input appears malformed: unterminated block comment")
+	case state.inString():
+		for _, c := range state.stack {
+			if c == '"' || c == '\'' {
+				return newError(ErrUnterminatedString, "input appears malformed: unterminated %c string", c)
+			}
+		}
+	case len(state.stack) > 0:
+		// Reporting the outermost as anything within it is likely fine.
+		c := string(state.stack[0])
+		if c == "$" {
+			c = "subexpression"
+		}
+		return newError(ErrUnbalancedBraces, "input appears malformed: unbalanced %s", c)
+	}
+
+	return nil
+}
+
+// balancedPrefix returns the number of lines from the start of lines that can
+// be minimized on their own. That is up to the last line ending with nothing
+// left open before the first unexpected closing bracket, if any.
+func balancedPrefix(lines []string) int {
+	var state lexState
+	var n int
+	for i := range lines {
+		state.scan(lines[i])
+		if state.unexpected != 0 {
+			break
+		}
+		if len(state.stack) == 0 && state.here == 0 && !state.comment {
+			n = i + 1
+		}
+	}
+
+	return n
+}
@@ -0,0 +1,57 @@
+package psminimize
+
+import (
+	"fmt"
+	"os"
+)
+
+// CommentsExt is added to the output path to name the file the comments
+// stripped from a script are saved to.
+const CommentsExt = ".comments"
+
+// LineComment is a comment, or the part of a block comment, found on a line
+// of the original script.
+type LineComment struct {
+	Line   int
+	Column int
+	Text   string
+}
+
+// CollectComments returns every comment within lines along with the line
+// and column, both starting from 1, it started at.
+func CollectComments(lines []string) []LineComment {
+	var comments []LineComment
+	var state lexState
+
+	for i := range lines {
+		var col int
+		for _, seg := range state.scan(lines[i]) {
+			if seg.Comment {
+				comments = append(comments, LineComment{Line: i + 1, Column: col + 1, Text: seg.Text})
+			}
+			col += len(seg.Text)
+		}
+	}
+
+	return comments
+}
+
+// SaveComments writes comments to the file at filePath, one per line as the
+// line and column separated by a colon, a tab and then the comment text.
+func SaveComments(comments []LineComment, filePath string, log LogFunc) error {
+	log.logf(LogSummary, "saving comments to: %s", filePath)
+
+	f, err := os.Create(filePath)
+	if err != nil {
+		return newError(ErrWrite, "%s: %s", ErrWrite, err)
+	}
+	defer f.Close()
+
+	for _, c := range comments {
+		if _, err := fmt.Fprintf(f, "%d:%d\t%s\n", c.Line, c.Column, c.Text); err != nil {
+			return newError(ErrWrite, "%s: %s", ErrWrite, err)
+		}
+	}
+
+	return nil
+}
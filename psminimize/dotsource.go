@@ -0,0 +1,121 @@
+package psminimize
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var (
+	// psDotSourceReg matches a line dot-sourcing a script capturing its path.
+	psDotSourceReg = regexp.MustCompile(`^\s*\.\s+([^\s;|(]+|"[^"]+"|'[^']+')\s*;?\s*$`)
+
+	// psScriptRootReg matches the $PSScriptRoot variable within a path.
+	psScriptRootReg = regexp.MustCompile(`(?i)\$(\{PSScriptRoot\}|PSScriptRoot)`)
+)
+
+// DotSourceReserved returns, for each of the scripts at paths, the
+// variables it shares with a script it dot-sources or that dot-sources it.
+// Both scripts run in the same scope so renaming a shared variable in only
+// one of them would break the other. Dot-sourced scripts that can not be
+// found are skipped.
+func DotSourceReserved(paths []string, log LogFunc) (map[string]map[string]string, error) {
+	vars := make(map[string]map[string]bool)
+	load := func(path string) (map[string]bool, []string, error) {
+		lines, _, err := ReadLines(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		stripAllComments(lines, nil)
+
+		if _, ok := vars[path]; !ok {
+			vars[path] = make(map[string]bool)
+			for _, v := range getVariables(lines, nil) {
+				vars[path][v.OriginalName] = true
+			}
+		}
+		return vars[path], lines, nil
+	}
+
+	reserved := make(map[string]map[string]string)
+	share := func(path string, name string) {
+		if reserved[path] == nil {
+			reserved[path] = make(map[string]string)
+		}
+		reserved[path][name] = ""
+	}
+
+	for _, path := range paths {
+		path = filepath.Clean(path)
+		pathVars, lines, err := load(path)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, source := range dotSourcedFiles(path, lines) {
+			sourceVars, _, err := load(source)
+			if os.IsNotExist(err) {
+				log.logf(LogSummary, "%s: dot-sourced %s not found", path, source)
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			for name := range pathVars {
+				if sourceVars[name] {
+					log.logf(LogVariables, "%s: %s is shared with %s", path, name, source)
+					share(path, name)
+					share(source, name)
+				}
+			}
+		}
+	}
+
+	return reserved, nil
+}
+
+// dotSourcedFiles returns the paths of the scripts dot-sourced within lines
+// of the script at path. Relative paths and $PSScriptRoot are resolved from
+// the directory of the script.
+func dotSourcedFiles(path string, lines []string) []string {
+	var files []string
+	dir := filepath.Dir(path)
+
+	for i := range lines {
+		r := psDotSourceReg.FindStringSubmatch(lines[i])
+		if r == nil {
+			continue
+		}
+
+		source := strings.Trim(r[1], "\"'")
+		source = psScriptRootReg.ReplaceAllLiteralString(source, dir)
+		source = filepath.FromSlash(strings.Replace(source, "\\", "/", -1))
+		if !filepath.IsAbs(source) {
+			source = filepath.Join(dir, source)
+		}
+		files = append(files, filepath.Clean(source))
+	}
+
+	return files
+}
+
+// WithReserved returns opts with the names in extra added to its reserved
+// variables, leaving the map of opts as it was.
+func WithReserved(opts Options, extra map[string]string) Options {
+	if len(extra) == 0 {
+		return opts
+	}
+
+	reserved := make(map[string]string, len(opts.Reserved)+len(extra))
+	for k, v := range opts.Reserved {
+		reserved[k] = v
+	}
+	for k, v := range extra {
+		reserved[k] = v
+	}
+	opts.Reserved = reserved
+
+	return opts
+}
@@ -0,0 +1,38 @@
+package psminimize
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestDotSourceTwoFiles(t *testing.T) {
+	inDir, outDir := t.TempDir(), t.TempDir()
+	writeScripts(t, inDir, map[string]string{
+		"main.ps1": ". $PSScriptRoot\\lib.ps1\n$shared = 1\n$local = Get-Shared\n$local + $shared\n",
+		"lib.ps1":  "function Get-Shared {\n  $inner = $shared * 2\n  $inner + $inner\n}\n",
+	})
+
+	reserved, err := DotSourceReserved([]string{filepath.Join(inDir, "main.ps1"), filepath.Join(inDir, "lib.ps1")}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"main.ps1", "lib.ps1"} {
+		vars := reserved[filepath.Join(inDir, name)]
+		if _, ok := vars["$SHARED"]; !ok || len(vars) != 1 {
+			t.Errorf("%s: got %v, want only $SHARED shared", name, vars)
+		}
+	}
+
+	if err := MinimizeBatch(inDir, outDir, Options{ResolveDotSource: true}, 2, 0, nil); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"main.ps1": ". $PSScriptRoot\\lib.ps1;$shared=1;$A=Get-Shared;$A+$shared;\n",
+		"lib.ps1":  "function Get-Shared{$A=$shared*2;$A+$A};\n",
+	}
+	for name := range want {
+		if got := readScript(t, outDir, name); got != want[name] {
+			t.Errorf("%s: got %q, want %q", name, got, want[name])
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package psminimize
+
+import (
+	"errors"
+	"fmt"
+)
+
+// The causes of the errors returned while minimizing. Every error caused by
+// the script or the options matches one of these with errors.Is so callers
+// can tell them apart. A file that can not be read is reported with the
+// error of the os package, such as one matching fs.ErrNotExist.
+var (
+	// ErrMalformedInput is returned for a script that can not be minimized
+	// reliably as something is never closed or closed without being opened.
+	ErrMalformedInput = errors.New("input appears malformed")
+
+	// ErrUnbalancedBraces is returned for a script with a bracket, brace or
+	// parenthesis that is never closed or closed without being opened. It
+	// also matches ErrMalformedInput.
+	ErrUnbalancedBraces = fmt.Errorf("%w: unbalanced brackets", ErrMalformedInput)
+
+	// ErrUnterminatedString is returned for a script with a string or
+	// here-string that is never closed, even one within a bracket that is
+	// never closed either. It also matches ErrMalformedInput.
+	ErrUnterminatedString = fmt.Errorf("%w: unterminated string", ErrMalformedInput)
+
+	// ErrFunctionNotFound is returned when a function to minimize is not
+	// defined by the script.
+	ErrFunctionNotFound = errors.New("function not found")
+
+	// ErrUnknownPass is returned when a pass name is not one of the passes.
+	ErrUnknownPass = errors.New("unknown pass")
+
+	// ErrUnknownOperator is returned when an operator to keep the spaces
+	// around is not one the spaces pass changes.
+	ErrUnknownOperator = errors.New("unknown operator")
+
+	// ErrUnknownFormat is returned when a metrics format or line ending is
+	// not one that can be written.
+	ErrUnknownFormat = errors.New("unknown format")
+
+	// ErrFirstLineOpen is returned when the first line is to be preserved
+	// but leaves a block comment, string, here-string or bracket open on the
+	// next.
+	ErrFirstLineOpen = errors.New("first line left open")
+
+	// ErrTooManyFiles is returned when a directory holds more scripts than
+	// allowed.
+	ErrTooManyFiles = errors.New("too many scripts")
+
+	// ErrBadPattern is returned when a pattern of scripts to exclude is
+	// malformed.
+	ErrBadPattern = errors.New("invalid pattern")
+
+	// ErrRenameCollision is returned when two variables would be renamed to
+	// the same name or one to the name of a variable that is kept.
+	ErrRenameCollision = errors.New("variable rename collision")
+
+	// ErrScriptsFailed is returned when any of the scripts of a directory or
+	// archive could not be minimized, each reported on its own.
+	ErrScriptsFailed = errors.New("scripts failed to minimize")
+
+	// ErrWrite is returned when the minimized script can not be written.
+	ErrWrite = errors.New("unable to write output")
+)
+
+// causeError is an error with its own message that matches its cause with
+// errors.Is.
+type causeError struct {
+	cause error
+	msg   string
+}
+
+func (e *causeError) Error() string { return e.msg }
+func (e *causeError) Unwrap() error { return e.cause }
+
+// newError returns an error with the formatted message that matches cause.
+func newError(cause error, format string, args ...interface{}) error {
+	return &causeError{cause: cause, msg: fmt.Sprintf(format, args...)}
+}
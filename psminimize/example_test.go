@@ -0,0 +1,40 @@
+package psminimize_test
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jrmycanady/psminimize/psminimize"
+)
+
+func ExampleMinifyString() {
+	script := "# Greets the user.\n$greeting = 'Hello'\nWrite-Host $greeting\n"
+
+	minimized, err := psminimize.MinifyString(script)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Print(minimized)
+	// Output: $A='Hello';Write-Host $A;
+}
+
+func ExampleMinimize() {
+	lines := []string{
+		"function Add-One($value) {",
+		"    # Adds one.",
+		"    return $value + 1",
+		"}",
+	}
+
+	minimized, err := psminimize.Minimize(lines, psminimize.Options{KeepNewlines: true})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Print(strings.Join(minimized, ""))
+	// Output:
+	// function Add-One($A){
+	// return $A+1
+	// }
+}
@@ -0,0 +1,224 @@
+package psminimize
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var psFunctionReg = regexp.MustCompile(`(?i)^\s*(function|filter|workflow)\s+([A-Za-z0-9_:.\-]+)`)
+
+// PSFunction represents the range of lines a function definition covers
+// in the PowerShell file.
+type PSFunction struct {
+	Name  string
+	Start int
+	End   int
+}
+
+// getFunctions retrieves all the functions defined in lines. Strings,
+// here-strings and comments are tracked by the lexer so braces or function
+// keywords within them are ignored.
+func getFunctions(lines []string) []PSFunction {
+	var psFuncs []PSFunction
+	var state lexState
+
+	for i := 0; i < len(lines); i++ {
+		r := psFunctionReg.FindStringSubmatch(lines[i])
+		if r == nil || state.inString() || state.comment {
+			state.scan(lines[i])
+			continue
+		}
+
+		// Walking forward until the braces opened by the function are
+		// closed again.
+		var depth int
+		var opened bool
+		end := -1
+		inner := state.clone()
+		for j := i; j < len(lines) && end < 0; j++ {
+			for _, d := range braceDeltas(lines[j], &inner) {
+				depth += d
+				if d > 0 {
+					opened = true
+				}
+				if opened && depth == 0 {
+					end = j
+					break
+				}
+			}
+		}
+		state.scan(lines[i])
+
+		// Ignoring functions that are never closed.
+		if end < 0 {
+			continue
+		}
+
+		psFuncs = append(psFuncs, PSFunction{Name: r[2], Start: i, End: end})
+	}
+
+	return psFuncs
+}
+
+// braceDeltas returns +1 for every opening and -1 for every closing brace
+// found in line, ignoring any within strings or comments. The state carries
+// anything left open by the previous line.
+func braceDeltas(line string, state *lexState) []int {
+	var deltas []int
+
+	for _, seg := range state.scan(line) {
+		if seg.Quoted || seg.Comment {
+			continue
+		}
+		for i := 0; i < len(seg.Text); i++ {
+			switch seg.Text[i] {
+			case charEscape:
+				i++
+			case '{':
+				deltas = append(deltas, 1)
+			case '}':
+				deltas = append(deltas, -1)
+			}
+		}
+	}
+
+	return deltas
+}
+
+// minimizeFunctions minimizes only the bodies of the functions named in
+// opts.OnlyFunctions leaving the rest of the lines untouched. Variables that
+// are also used outside of the selected functions, or in more than one of
+// them, or share their name with a named argument passed outside of them,
+// are not renamed as each function is given its names on its own.
+func minimizeFunctions(lines []string, opts Options) ([]string, error) {
+	stripped := make([]string, len(lines))
+	copy(stripped, lines)
+	stripAllComments(stripped, nil)
+
+	// Finding the requested functions, skipping any nested within a function
+	// already selected.
+	var selected []PSFunction
+	for _, f := range getFunctions(stripped) {
+		for _, n := range opts.OnlyFunctions {
+			if strings.EqualFold(f.Name, strings.TrimSpace(n)) {
+				selected = append(selected, f)
+				break
+			}
+		}
+	}
+
+	for _, n := range opts.OnlyFunctions {
+		var found bool
+		for _, f := range selected {
+			found = found || strings.EqualFold(f.Name, strings.TrimSpace(n))
+		}
+		if !found {
+			return nil, newError(ErrFunctionNotFound, "function %s not found", strings.TrimSpace(n))
+		}
+	}
+
+	var ranges []PSFunction
+	for _, f := range selected {
+		if len(ranges) > 0 && f.Start <= ranges[len(ranges)-1].End {
+			continue
+		}
+		ranges = append(ranges, f)
+	}
+
+	// Any variable used outside the selected functions must keep its name.
+	var outside []string
+	var last int
+	for _, f := range ranges {
+		outside = append(outside, stripped[last:f.Start]...)
+		last = f.End + 1
+	}
+	outside = append(outside, stripped[last:]...)
+	funcOpts := opts
+	funcOpts.Reserved = make(map[string]string)
+	for k, v := range opts.Reserved {
+		funcOpts.Reserved[k] = v
+	}
+	for _, v := range getVariables(outside, nil) {
+		funcOpts.Reserved[v.OriginalName] = ""
+	}
+	for k := range getNamedArguments(outside) {
+		funcOpts.Reserved[k] = ""
+	}
+
+	// A variable shared by the selected functions, such as one of the script
+	// scope or reached through dynamic scope, would be given a different
+	// name by each.
+	shared := make(map[string]int)
+	for _, f := range ranges {
+		for _, v := range getVariables(stripped[f.Start:f.End+1], nil) {
+			shared[v.OriginalName]++
+		}
+	}
+	for k, n := range shared {
+		if n > 1 {
+			funcOpts.Reserved[k] = ""
+		}
+	}
+
+	minimizedLines := make([]string, 0, len(lines))
+	last = 0
+	for _, f := range ranges {
+		for i := last; i < f.Start; i++ {
+			minimizedLines = append(minimizedLines, lines[i]+lineEnding(opts))
+		}
+		body, err := minimizeLines(lines[f.Start:f.End+1], funcOpts)
+		if err != nil {
+			return nil, err
+		}
+		minimizedLines = endLine(append(minimizedLines, body...), lineEnding(opts))
+		last = f.End + 1
+	}
+	for i := last; i < len(lines); i++ {
+		minimizedLines = append(minimizedLines, lines[i]+lineEnding(opts))
+	}
+
+	return minimizedLines, nil
+}
+
+// minimizeToTarget minimizes the largest functions in lines one at a time,
+// leaving the rest of the script as it is, until the output is no larger than
+// target bytes. The names of the functions minimized are logged. If the
+// target can not be reached every function is left minimized.
+func minimizeToTarget(lines []string, opts Options, target int) ([]string, error) {
+	output := make([]string, len(lines))
+	for i := range lines {
+		output[i] = lines[i] + lineEnding(opts)
+	}
+
+	// Only the outermost functions are minimized as a whole.
+	var funcs []PSFunction
+	for _, f := range getFunctions(lines) {
+		if len(funcs) > 0 && f.Start <= funcs[len(funcs)-1].End {
+			continue
+		}
+		funcs = append(funcs, f)
+	}
+	sizes := make(map[int]int)
+	for _, f := range funcs {
+		sizes[f.Start] = GetLength(output[f.Start : f.End+1])
+	}
+	sort.SliceStable(funcs, func(i, j int) bool { return sizes[funcs[i].Start] > sizes[funcs[j].Start] })
+
+	for i := 0; i < len(funcs) && GetLength(FinishOutput(output, opts)) > target; i++ {
+		opts.OnlyFunctions = append(opts.OnlyFunctions, funcs[i].Name)
+		opts.Log.logf(LogSummary, "minimizing function %s (%d bytes)", funcs[i].Name, sizes[funcs[i].Start])
+
+		var err error
+		output, err = minimizeFunctions(lines, opts)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if l := GetLength(FinishOutput(output, opts)); l > target {
+		opts.Log.logf(LogSummary, "target of %d bytes not reached, output is %d bytes", target, l)
+	}
+
+	return output, nil
+}
@@ -0,0 +1,214 @@
+package psminimize
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var (
+	// psHelpReg matches a comment based help keyword such as .SYNOPSIS.
+	psHelpReg = regexp.MustCompile(`(?im)^\s*(<#)?\s*\.(SYNOPSIS|DESCRIPTION|PARAMETER|EXAMPLE|INPUTS|OUTPUTS|NOTES|LINK|COMPONENT|ROLE|FUNCTIONALITY|FORWARDHELPTARGETNAME|FORWARDHELPCATEGORY|REMOTEHELPRUNSPACE|EXTERNALHELP)\b`)
+
+	// psExportReg matches an Export-ModuleMember call capturing its
+	// arguments.
+	psExportReg = regexp.MustCompile(`(?i)^\s*Export-ModuleMember\b(.*)`)
+
+	// psExportFuncReg matches the -Function parameter and what follows it.
+	psExportFuncReg = regexp.MustCompile(`(?i)-Function\s+(.*)`)
+
+	// psNextParamReg matches the start of the next parameter.
+	psNextParamReg = regexp.MustCompile(`\s-[A-Za-z]`)
+)
+
+// helpMarker returns the text standing in for the nth help block kept while
+// the passes are run. It holds nothing any pass changes.
+func helpMarker(n int) string {
+	return fmt.Sprintf("~~PSMINIMIZEHELP%d~~", n)
+}
+
+// extractPublicHelp replaces the comment based help of every public
+// function in lines with a marker so it is not stripped, returning the help
+// blocks in marker order. The help is either the block comment just before
+// the function or the first thing within its body. A function is public when
+// exported by Export-ModuleMember, or always if the script exports nothing.
+func extractPublicHelp(lines []string) []string {
+	exported, all := getExportedFunctions(lines)
+
+	var help []string
+	for _, f := range getFunctions(lines) {
+		if !all && !isExported(f.Name, exported) {
+			continue
+		}
+
+		start, end := helpBefore(lines, f.Start)
+		if start < 0 {
+			start, end = helpWithin(lines, f.Start)
+		}
+		if start < 0 {
+			continue
+		}
+
+		help = append(help, strings.Join(lines[start:end+1], "\n"))
+		lines[start] = helpMarker(len(help) - 1)
+		for i := start + 1; i <= end; i++ {
+			lines[i] = ""
+		}
+	}
+
+	return help
+}
+
+// restoreHelp puts the help blocks back in place of their markers within
+// the minimized lines, each on lines of its own.
+func restoreHelp(lines []string, help []string) []string {
+	for n := range help {
+		marker := helpMarker(n)
+		for i := range lines {
+			idx := strings.Index(lines[i], marker)
+			if idx < 0 {
+				continue
+			}
+
+			prev := byte('\n')
+			if idx > 0 {
+				prev = lines[i][idx-1]
+			} else if i > 0 && lines[i-1] != "" {
+				prev = lines[i-1][len(lines[i-1])-1]
+			}
+			prefix := ""
+			if prev != '\n' {
+				prefix = "\n"
+			}
+
+			rest := strings.TrimPrefix(lines[i][idx+len(marker):], ";")
+			if !strings.HasPrefix(rest, "\n") {
+				rest = "\n" + rest
+			}
+			lines[i] = lines[i][:idx] + prefix + help[n] + rest
+			break
+		}
+	}
+
+	return lines
+}
+
+// getExportedFunctions returns the function names or wildcard patterns
+// passed to Export-ModuleMember in lines. all is true when every function is
+// public, either as nothing is exported or the names can not be told.
+func getExportedFunctions(lines []string) ([]string, bool) {
+	var names []string
+	var found bool
+
+	for i := range lines {
+		r := psExportReg.FindStringSubmatch(lines[i])
+		if r == nil {
+			continue
+		}
+		found = true
+
+		// The first positional argument is -Function.
+		args := strings.TrimSpace(r[1])
+		if m := psExportFuncReg.FindStringSubmatch(args); m != nil {
+			args = m[1]
+		} else if strings.HasPrefix(args, "-") {
+			continue
+		}
+		if loc := psNextParamReg.FindStringIndex(args); loc != nil {
+			args = args[:loc[0]]
+		}
+
+		for _, n := range strings.FieldsFunc(args, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' }) {
+			n = strings.Trim(n, "\"'@()")
+			if strings.HasPrefix(n, "$") {
+				return nil, true
+			}
+			if n != "" {
+				names = append(names, n)
+			}
+		}
+	}
+
+	return names, !found
+}
+
+// isExported returns true if name matches any of the exported names or
+// patterns, ignoring case.
+func isExported(name string, exported []string) bool {
+	for _, e := range exported {
+		if ok, _ := filepath.Match(strings.ToLower(e), strings.ToLower(name)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// helpBefore returns the first and last line of the help block ending just
+// before the function at line fn, allowing a single blank line between, or
+// -1 if there is none.
+func helpBefore(lines []string, fn int) (int, int) {
+	end := fn - 1
+	if end >= 0 && strings.TrimSpace(lines[end]) == "" {
+		end--
+	}
+	if end < 0 || !strings.HasSuffix(strings.TrimSpace(lines[end]), "#>") {
+		return -1, -1
+	}
+
+	for start := end; start >= 0; start-- {
+		if strings.HasPrefix(strings.TrimSpace(lines[start]), "<#") {
+			return helpBlock(lines, start, end)
+		}
+	}
+	return -1, -1
+}
+
+// helpWithin returns the first and last line of the help block starting the
+// body of the function at line fn or -1 if there is none.
+func helpWithin(lines []string, fn int) (int, int) {
+	start := fn + 1
+	if !strings.HasSuffix(strings.TrimSpace(lines[fn]), "{") {
+		for start < len(lines) && strings.TrimSpace(lines[start]) == "" {
+			start++
+		}
+		if start >= len(lines) || strings.TrimSpace(lines[start]) != "{" {
+			return -1, -1
+		}
+		start++
+	}
+	for start < len(lines) && strings.TrimSpace(lines[start]) == "" {
+		start++
+	}
+	if start >= len(lines) || !strings.HasPrefix(strings.TrimSpace(lines[start]), "<#") {
+		return -1, -1
+	}
+
+	for end := start; end < len(lines); end++ {
+		if strings.Contains(lines[end], "#>") {
+			return helpBlock(lines, start, end)
+		}
+	}
+	return -1, -1
+}
+
+// helpBlock returns start and end if the lines between them hold nothing
+// but a single block comment with a help keyword, or -1 otherwise.
+func helpBlock(lines []string, start int, end int) (int, int) {
+	var state lexState
+	for i := start; i <= end; i++ {
+		for _, seg := range state.scan(lines[i]) {
+			if !seg.Comment && strings.TrimSpace(seg.Text) != "" {
+				return -1, -1
+			}
+		}
+		if !state.comment && i < end {
+			return -1, -1
+		}
+	}
+
+	if !psHelpReg.MatchString(strings.Join(lines[start:end+1], "\n")) {
+		return -1, -1
+	}
+	return start, end
+}
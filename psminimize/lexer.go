@@ -0,0 +1,269 @@
+package psminimize
+
+import "strings"
+
+// segment is a run of characters within a line that share the same lexical
+// context. String segments include their quote characters and comment
+// segments their comment characters. A verbatim segment is a string taken
+// as it is, a single-quoted string or here-string or the arguments after a
+// --%, so a $ within it does not start a variable.
+type segment struct {
+	Text     string
+	Quoted   bool
+	Comment  bool
+	Verbatim bool
+}
+
+// lexState tracks the strings and subexpressions left open at the end of a
+// line so the following line can be scanned in the right context. Every
+// entry in the stack is the character that opened it: a quote for a string,
+// the bracket for a parenthesis, brace or square bracket and $ for a $( or
+// @( subexpression. An open here-string is tracked by its quote
+// in here as everything up to the line closing it is part of the string,
+// the same goes for an open block comment. The first closing bracket that
+// did not match what was open is kept in unexpected. The arguments after a
+// --% stop-parsing token are passed as they are up to the end of the line or
+// a pipe so they are scanned as a string, with literal set when they reach
+// the end of the line.
+type lexState struct {
+	stack      []byte
+	here       byte
+	comment    bool
+	unexpected byte
+	literal    bool
+}
+
+// top returns the innermost open context or 0 if there is none.
+func (s *lexState) top() byte {
+	if len(s.stack) == 0 {
+		return 0
+	}
+	return s.stack[len(s.stack)-1]
+}
+
+func (s *lexState) push(c byte) {
+	s.stack = append(s.stack, c)
+}
+
+func (s *lexState) pop() {
+	if len(s.stack) > 0 {
+		s.stack = s.stack[:len(s.stack)-1]
+	}
+}
+
+// clone returns a copy of the state that can be scanned on its own.
+func (s *lexState) clone() lexState {
+	c := *s
+	c.stack = append([]byte(nil), s.stack...)
+	return c
+}
+
+// quoted returns true if the innermost open context is a string.
+func (s *lexState) quoted() bool {
+	return s.here != 0 || s.top() == '"' || s.top() == '\''
+}
+
+// verbatim returns true if the innermost open context is a single-quoted
+// string or here-string.
+func (s *lexState) verbatim() bool {
+	if s.here != 0 {
+		return s.here == '\''
+	}
+	return s.top() == '\''
+}
+
+// inString returns true if a string is open at any level, including when
+// within a subexpression of a string.
+func (s *lexState) inString() bool {
+	if s.here != 0 {
+		return true
+	}
+	for _, c := range s.stack {
+		if c == '"' || c == '\'' {
+			return true
+		}
+	}
+	return false
+}
+
+// scan splits line into string and code segments starting from the current
+// state and leaves the state as it is at the end of the line.
+func (s *lexState) scan(line string) []segment {
+	var segs []segment
+	var start int
+	quoted, comment, verbatim := s.quoted(), s.comment, s.verbatim()
+	s.literal = false
+
+	// cut ends the current segment before i and starts a new one using the
+	// context of the state at that point.
+	cut := func(i int) {
+		if i > start {
+			segs = append(segs, segment{Text: line[start:i], Quoted: quoted, Comment: comment, Verbatim: verbatim})
+		}
+		start = i
+		quoted, comment, verbatim = s.quoted(), s.comment, s.verbatim()
+	}
+
+	// A block comment ends at the first #> found.
+	if s.comment {
+		end := strings.Index(line, "#>")
+		if end < 0 {
+			return []segment{{Text: line, Comment: true}}
+		}
+		s.comment = false
+		cut(end + 2)
+	}
+
+	// A here-string only ends on a line starting with its closing quote.
+	if s.here != 0 {
+		if !strings.HasPrefix(line, string(s.here)+"@") {
+			return []segment{{Text: line, Quoted: true, Verbatim: s.here == '\''}}
+		}
+		s.here = 0
+		cut(2)
+	}
+
+	for i := start; i < len(line); i++ {
+		switch s.top() {
+		case '"':
+			// Only a backtick escapes, a backslash such as the one ending
+			// "C:\temp\" is an ordinary character.
+			switch {
+			case line[i] == charEscape:
+				i++
+			case line[i] == '"' && i+1 < len(line) && line[i+1] == '"':
+				i++
+			case line[i] == '"':
+				s.pop()
+				cut(i + 1)
+			case line[i] == '$' && i+1 < len(line) && line[i+1] == '(':
+				s.push('$')
+				cut(i)
+				i++
+			}
+		case '\'':
+			switch {
+			case line[i] == '\'' && i+1 < len(line) && line[i+1] == '\'':
+				i++
+			case line[i] == '\'':
+				s.pop()
+				cut(i + 1)
+			}
+		default:
+			switch line[i] {
+			case charEscape:
+				i++
+			case '"', '\'':
+				s.push(line[i])
+				cut(i)
+			case '$':
+				if i+1 < len(line) && line[i+1] == '(' {
+					s.push('$')
+					i++
+				}
+			case '@':
+				// A here-string opens when nothing but whitespace follows.
+				if i+1 < len(line) && (line[i+1] == '"' || line[i+1] == '\'') && strings.TrimSpace(line[i+2:]) == "" {
+					s.here = line[i+1]
+					cut(i)
+					i = len(line)
+				} else if i+1 < len(line) && line[i+1] == '(' {
+					s.push('$')
+					i++
+				}
+			case '<':
+				if i+1 < len(line) && line[i+1] == charComment {
+					s.comment = true
+					cut(i)
+					end := strings.Index(line[i+2:], "#>")
+					if end < 0 {
+						i = len(line)
+						break
+					}
+					i += end + 3
+					s.comment = false
+					cut(i + 1)
+				}
+			case '-':
+				if strings.HasPrefix(line[i:], "--%") && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t') {
+					cut(i)
+					end := strings.IndexByte(line[i:], '|')
+					if end < 0 {
+						end = len(line) - i
+						s.literal = true
+					}
+					segs = append(segs, segment{Text: line[i : i+end], Quoted: true, Verbatim: true})
+					start = i + end
+					i = start - 1
+				}
+			case charComment:
+				// A comment only starts at the start of a token and runs to
+				// the end of the line.
+				if commentStarts(line, i) {
+					cut(i)
+					return append(segs, segment{Text: line[i:], Comment: true})
+				}
+			case '(', '{', '[':
+				s.push(line[i])
+			case ')', '}', ']':
+				switch {
+				case line[i] == ')' && s.top() == '$':
+					s.pop()
+					cut(i + 1)
+				case s.top() == openingBracket(line[i]):
+					s.pop()
+				case s.unexpected == 0:
+					s.unexpected = line[i]
+				}
+			}
+		}
+	}
+	cut(len(line))
+
+	return segs
+}
+
+// openingBracket returns the bracket opened by the closing bracket c.
+func openingBracket(c byte) byte {
+	switch c {
+	case ')':
+		return '('
+	case '}':
+		return '{'
+	case ']':
+		return '['
+	}
+	return 0
+}
+
+// commentStarts returns true if the # at i in line starts a comment. That is
+// when it starts a token, either after whitespace or punctuation or after a
+// variable or number which can not contain a #. Within any other word, such
+// as a command argument, it is part of the word.
+func commentStarts(line string, i int) bool {
+	if i == 0 || strings.IndexByte(" \t;|&(){},=", line[i-1]) >= 0 {
+		return true
+	}
+
+	start := i
+	for start > 0 && isWordByte(line[start-1]) {
+		start--
+	}
+	if start > 0 && line[start-1] == '$' {
+		return true
+	}
+	if start == i {
+		return false
+	}
+	for j := start; j < i; j++ {
+		if line[j] < '0' || line[j] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// isWordByte returns true if c can be part of a variable name.
+func isWordByte(c byte) bool {
+	return c == '_' || c == ':' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
@@ -0,0 +1,85 @@
+package psminimize
+
+import (
+	"strings"
+	"testing"
+)
+
+// renderSegments writes segs as kind:text separated by |, the kind being c
+// for code, q for a string, v for a verbatim string and # for a comment.
+func renderSegments(segs []segment) string {
+	parts := make([]string, len(segs))
+	for i, seg := range segs {
+		kind := "c"
+		switch {
+		case seg.Comment:
+			kind = "#"
+		case seg.Verbatim:
+			kind = "v"
+		case seg.Quoted:
+			kind = "q"
+		}
+		parts[i] = kind + ":" + seg.Text
+	}
+	return strings.Join(parts, "|")
+}
+
+func TestScan(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		want  []string
+	}{
+		{
+			"nested quotes and subexpressions",
+			[]string{`$x = "a $("b" + 'c') d" # e`},
+			[]string{`c:$x = |q:"a |c:$(|q:"b"|c: + |v:'c'|c:)|q: d"|c: |#:# e`},
+		},
+		{
+			"subexpression spanning lines",
+			[]string{`$u = "sum: $(`, `  1 + 'x'`, `) done"`},
+			[]string{`c:$u = |q:"sum: |c:$(`, `c:  1 + |v:'x'`, `c:)|q: done"`},
+		},
+		{
+			"backtick escapes",
+			[]string{"Write-Host \"`\"a`\" `$b\" `# c # d"},
+			[]string{"c:Write-Host |q:\"`\"a`\" `$b\"|c: `# c |#:# d"},
+		},
+		{
+			"doubled quotes",
+			[]string{`$a = 'it''s # in' + "say ""#hi"""`},
+			[]string{`c:$a = |v:'it''s # in'|c: + |q:"say ""#hi"""`},
+		},
+		{
+			"here-strings",
+			[]string{`$s = @"`, `text # not a comment $(1)`, `"@ + 'x' # y`, `$t = @'`, `'@`},
+			[]string{`c:$s = |q:@"`, `q:text # not a comment $(1)`, `q:"@|c: + |v:'x'|c: |#:# y`, `c:$t = |v:@'`, `v:'@`},
+		},
+		{
+			"block comments",
+			[]string{`<# start`, `middle "`, `end #> $z # tail`, `$a = 1 <# inline #> + 1`},
+			[]string{`#:<# start`, `#:middle "`, `#:end #>|c: $z |#:# tail`, `c:$a = 1 |#:<# inline #>|c: + 1`},
+		},
+		{
+			"stop parsing",
+			[]string{`icacls.exe C:\dir --% /grant # not a comment`, `cmd --% /c echo # x | Out-Host # y`},
+			[]string{`c:icacls.exe C:\dir |v:--% /grant # not a comment`, `c:cmd |v:--% /c echo # x |c:| Out-Host |#:# y`},
+		},
+		{
+			"hash within a word",
+			[]string{`Write-Host a#b # c`},
+			[]string{`c:Write-Host a#b |#:# c`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var state lexState
+			for i, line := range tt.lines {
+				if got := renderSegments(state.scan(line)); got != tt.want[i] {
+					t.Errorf("line %d: got %q, want %q", i+1, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package psminimize
+
+import (
+	"fmt"
+	"io"
+)
+
+// Verbosity levels for diagnostics, each including everything below it.
+const (
+	LogNone      = 0
+	LogSummary   = 1
+	LogPasses    = 2
+	LogVariables = 3
+	LogLines     = 4
+)
+
+// LogFunc writes a diagnostic message if the verbosity is at least level.
+type LogFunc func(level int, format string, args ...interface{})
+
+// logf calls f if it is set.
+func (f LogFunc) logf(level int, format string, args ...interface{}) {
+	if f != nil {
+		f(level, format, args...)
+	}
+}
+
+// NewLogger returns a function for Options.Log writing every message up to
+// verbosity to w.
+func NewLogger(w io.Writer, verbosity int) LogFunc {
+	return func(level int, format string, args ...interface{}) {
+		if level <= verbosity {
+			fmt.Fprintf(w, format+"\n", args...)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package psminimize
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewLoggerLevels(t *testing.T) {
+	// One message written at each level, found by how it starts.
+	messages := []struct {
+		level  int
+		prefix string
+	}{
+		{LogSummary, "saving to: "},
+		{LogPasses, "comments: "},
+		{LogVariables, "variables: $X => $A"},
+		{LogLines, "newlines: line 1 joined"},
+	}
+
+	for verbosity := LogNone; verbosity <= LogLines; verbosity++ {
+		var b strings.Builder
+		opts := Options{Log: NewLogger(&b, verbosity)}
+		lines, err := Minimize([]string{"$x = 1 # one", "$x"}, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := SaveToFile(lines, filepath.Join(t.TempDir(), "out.ps1"), opts.Log); err != nil {
+			t.Fatal(err)
+		}
+
+		got := b.String()
+		if verbosity == LogNone && got != "" {
+			t.Errorf("verbosity 0: got %q, want nothing", got)
+		}
+		for _, m := range messages {
+			found := strings.HasPrefix(got, m.prefix) || strings.Contains(got, "\n"+m.prefix)
+			if found != (m.level <= verbosity) {
+				t.Errorf("verbosity %d: %q written is %t, want %t", verbosity, m.prefix, found, !found)
+			}
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package psminimize
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Metrics are the statistics of minimizing a script.
+type Metrics struct {
+	OriginalBytes  int
+	MinimizedBytes int
+	Duration       time.Duration
+}
+
+// ReductionRatio returns the fraction of the original bytes that were
+// removed.
+func (m Metrics) ReductionRatio() float64 {
+	return PercentReduced(m.OriginalBytes, m.MinimizedBytes) / 100
+}
+
+// metricsWriters write the metrics in each of the formats by name.
+var metricsWriters = map[string]func(io.Writer, Metrics) error{
+	"json":       writeMetricsJSON,
+	"prometheus": writeMetricsPrometheus,
+}
+
+// ValidMetricsFormat returns true if format is one WriteMetrics can write.
+func ValidMetricsFormat(format string) bool {
+	_, ok := metricsWriters[format]
+	return ok
+}
+
+// WriteMetrics writes m to w in the format named, json or prometheus.
+func WriteMetrics(w io.Writer, format string, m Metrics) error {
+	write, ok := metricsWriters[format]
+	if !ok {
+		return newError(ErrUnknownFormat, "unknown metrics format %s", format)
+	}
+	return write(w, m)
+}
+
+// writeMetricsJSON writes m as a single JSON object.
+func writeMetricsJSON(w io.Writer, m Metrics) error {
+	return json.NewEncoder(w).Encode(struct {
+		OriginalBytes   int     `json:"original_bytes"`
+		MinimizedBytes  int     `json:"minimized_bytes"`
+		ReductionRatio  float64 `json:"reduction_ratio"`
+		DurationSeconds float64 `json:"duration_seconds"`
+	}{m.OriginalBytes, m.MinimizedBytes, m.ReductionRatio(), m.Duration.Seconds()})
+}
+
+// writeMetricsPrometheus writes m as gauges in the Prometheus text
+// exposition format.
+func writeMetricsPrometheus(w io.Writer, m Metrics) error {
+	gauges := []struct {
+		Name  string
+		Help  string
+		Value float64
+	}{
+		{"psminimize_original_bytes", "Size of the script before it was minimized.", float64(m.OriginalBytes)},
+		{"psminimize_minimized_bytes", "Size of the minimized script.", float64(m.MinimizedBytes)},
+		{"psminimize_reduction_ratio", "Fraction of the original size that was removed.", m.ReductionRatio()},
+		{"psminimize_duration_seconds", "Time taken to minimize the script.", m.Duration.Seconds()},
+	}
+
+	for _, g := range gauges {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %g\n", g.Name, g.Help, g.Name, g.Name, g.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
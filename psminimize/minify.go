@@ -0,0 +1,42 @@
+// Package psminimize minimizes PowerShell scripts by stripping comments and
+// whitespace and renaming variables to the shortest names available. It is
+// what the psminimize command runs and can be used on its own to minimize
+// scripts from other tools.
+package psminimize
+
+import (
+	"io"
+	"strings"
+)
+
+// Minify minimizes the script read from input with the default options and
+// writes the result to output.
+func Minify(input io.Reader, output io.Writer) error {
+	return MinifyWith(input, output, Options{})
+}
+
+// MinifyString returns script minimized with the default options.
+func MinifyString(script string) (string, error) {
+	var b strings.Builder
+	if err := Minify(strings.NewReader(script), &b); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// MinifyWith minimizes the script read from input as configured by opts and
+// writes the result to output, guarded by GuardGrowth and wrapped as
+// FinishOutput does.
+func MinifyWith(input io.Reader, output io.Writer, opts Options) error {
+	lines, err := ReadLinesFrom(input)
+	if err != nil {
+		return err
+	}
+
+	minimized, err := Minimize(lines, opts)
+	if err != nil {
+		return err
+	}
+
+	return writeLines(output, FinishOutput(GuardGrowth(lines, minimized, opts), opts))
+}
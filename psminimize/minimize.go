@@ -0,0 +1,1272 @@
+package psminimize
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/google/uuid"
+)
+
+// charComment starts a comment and charEscape escapes the character after
+// it.
+const (
+	charComment byte = '#'
+	charEscape  byte = '`'
+)
+
+var (
+	// psVarReg matches a variable along with any backtick escaping it. The
+	// first group holds what is within the braces of a ${name} and otherwise
+	// the second holds any scope or drive and the third the name.
+	psVarReg = regexp.MustCompile("[`]?\\$(?:\\{([^}]*)\\}|(?:([A-Za-z_][A-Za-z0-9_]*):)?([A-Za-z0-9_]+))")
+
+	// psNameReg matches a name a variable can be renamed from or to.
+	psNameReg = regexp.MustCompile("^[A-Za-z0-9_]+$")
+
+	// psSplatReg matches a variable being splatted such as @params along
+	// with the character before it.
+	psSplatReg = regexp.MustCompile("(^|[\\s(;,])@([A-Z0-9a-z_]+)")
+
+	// psNamedArgReg matches a named argument such as -Path along with the
+	// character before it.
+	psNamedArgReg = regexp.MustCompile("(^|[\\s(;,{|])-([A-Za-z_][A-Z0-9a-z_]*)")
+
+	// psComparisonReg matches a comparison operator, in any case, along
+	// with a space on either side of it.
+	psComparisonReg = regexp.MustCompile(`(?i) ?(-(?:eq|gt|lt|ne|le|ge)\b) ?`)
+
+	// psVarCmdletReg matches a call to one of the variable cmdlets, or their
+	// aliases, capturing its arguments.
+	psVarCmdletReg = regexp.MustCompile(`(?i)(?:^|[\s;|({])(?:(?:get|set|remove|clear|new)-variable|gv|sv|rv|clv|nv)\s+([^;|)}]*)`)
+
+	// psVarCmdletValueParams are the parameters of the variable cmdlets that
+	// take a value, other than -Name.
+	psVarCmdletValueParams = map[string]bool{
+		"value": true, "scope": true, "option": true, "description": true,
+		"visibility": true, "include": true, "exclude": true,
+	}
+
+	// psAttributeReg matches a line holding just an attribute that takes
+	// arguments, such as [CmdletBinding()] or [OutputType([string])].
+	psAttributeReg = regexp.MustCompile(`^\[[\w.]+\(.*\)\]$`)
+
+	// psParamEndReg matches a line ending in the param keyword, as a word of
+	// its own rather than the end of a variable or command name.
+	psParamEndReg = regexp.MustCompile(`(?i)(?:^|[^\w$:-])param$`)
+
+	// psOperatorEndReg matches a line ending with a logical, comparison or
+	// other word operator that follows an operand, leaving the expression to
+	// go on with the next line. Only an operand that can not be a command
+	// name is matched so a switch parameter such as -NotMatch is not.
+	psOperatorEndReg = regexp.MustCompile(`(?i)(\$[\w:]+|[)\]}"'0-9])\s*-(and|or|xor|not|band|bor|bxor|bnot|[ci]?(eq|ne|gt|ge|lt|le|like|notlike|match|notmatch|contains|notcontains|in|notin|replace|split)|is|isnot|as|join|f|shl|shr)$`)
+
+	// psContinuationKeywords are the keywords that go on with the statement
+	// of the block closed before them.
+	psContinuationKeywords = map[string]bool{"catch": true, "finally": true, "else": true, "elseif": true}
+
+	// psBlockKeywords are the keywords of statements taking a block that may
+	// start on the following line.
+	psBlockKeywords = map[string]bool{
+		"if": true, "elseif": true, "else": true, "switch": true, "foreach": true, "for": true,
+		"while": true, "do": true, "try": true, "catch": true, "finally": true, "trap": true,
+		"function": true, "filter": true, "begin": true, "process": true, "end": true,
+		"dynamicparam": true, "class": true, "enum": true,
+	}
+
+	// psBracketSpaceReg matches a closing square bracket followed by a
+	// space that is not followed by a -.
+	psBracketSpaceReg = regexp.MustCompile(`\] ([^-]|$)`)
+)
+
+// shortNameFirst and shortNameRest are the characters a short name starts
+// with and goes on with. Lower case letters are left out as PowerShell
+// ignores case so $a is the same variable as $A.
+const (
+	shortNameFirst = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	shortNameRest  = "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+)
+
+// shortName returns the nth short name counting from zero: A to Z, then AA
+// to Z9 and so on. Every n gives a different name, never running out, and
+// the shorter names always come first.
+func shortName(n int) string {
+	name := []byte{shortNameFirst[n%len(shortNameFirst)]}
+	for n /= len(shortNameFirst); n > 0; n /= len(shortNameRest) {
+		n--
+		name = append(name, shortNameRest[n%len(shortNameRest)])
+	}
+
+	return string(name)
+}
+
+// PSVariable represents a variable found in the PowerShell file.
+type PSVariable struct {
+	OriginalName string
+	UniqueName   string
+	ShortName    string
+	Count        int
+	Reserved     bool
+	SourceLine   string
+}
+
+// PSVariables represents a slice of PSVariable structs that can be
+// sorted.
+type PSVariables []PSVariable
+
+func (p PSVariables) Len() int           { return len(p) }
+func (p PSVariables) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+func (p PSVariables) Less(i, j int) bool { return p[i].Count > p[j].Count }
+
+// assignUniqueRandomNames assigns a unique random name to every variable.
+func (p PSVariables) assignUniqueRandomNames() error {
+	for i := range p {
+		id, err := uuid.NewRandom()
+		if err != nil {
+			return err
+		}
+		p[i].UniqueName = fmt.Sprintf("$~~%s", strings.ToUpper(id.String()))
+	}
+	sort.Sort(PSVariablesNameMod(p))
+
+	return nil
+}
+
+// replaceVariablesWithUnique replaces all the variables with their unique
+// name. Each variable found is looked up ignoring case and everything else,
+// reserved variables included, is left as is.
+func (p PSVariables) replaceVariablesWithUnique(lines []string, report progressFunc) {
+	sort.Sort(PSVariablesNameMod(p))
+	unique := make(map[string]string)
+	for j := range p {
+		if !p[j].Reserved {
+			unique[p[j].OriginalName] = p[j].UniqueName
+		}
+	}
+
+	// Splatted variables are the same variable referenced with an @ so
+	// they are replaced along with the rest in the order they appear.
+	refs := findScriptVariables(lines)
+	splats := findScriptSplats(lines)
+	for i := range lines {
+		lineRefs := append(refs[i], splats[i]...)
+		sort.Slice(lineRefs, func(a, b int) bool { return lineRefs[a].NameStart < lineRefs[b].NameStart })
+
+		// Replacing the name of whole variables only so one is never matched
+		// within another or within an escaped ``$name. Any scope or braces
+		// are kept as they are.
+		var l strings.Builder
+		var last int
+		for _, v := range lineRefs {
+			if u, ok := unique[v.Key]; ok {
+				l.WriteString(lines[i][last:v.NameStart])
+				l.WriteString(u[1:])
+				last = v.NameEnd
+			}
+		}
+		l.WriteString(lines[i][last:])
+		lines[i] = l.String()
+		report.report(i + 1)
+	}
+}
+
+// replaceUniqueWithShort replaces all unique variables with the short version.
+func (p PSVariables) replaceUniqueWithShort(lines []string, report progressFunc) {
+	sort.Sort(PSVariablesNameMod(p))
+
+	// The unique name is replaced without its $ as it may follow a scope, an
+	// opening brace or the @ of a splat.
+	pairs := make([]string, 0, 2*len(p))
+	for j := range p {
+		pairs = append(pairs, p[j].UniqueName[1:], p[j].ShortName[1:])
+	}
+	replacer := strings.NewReplacer(pairs...)
+	for i := range lines {
+		lines[i] = replacer.Replace(lines[i])
+		report.report(i + 1)
+	}
+}
+
+// Sort sorts the PSVariable by count.
+func (p PSVariables) Sort() {
+	sort.Sort(p)
+}
+
+// generateShortNames generates short names for all variables making sure
+// the more used variables have the shortest name. Any name already used by
+// a variable in the script or a reserved variable, or already generated, is
+// skipped ignoring case so a generated name can never collide with another.
+// Every name starts with prefix, letting scripts that are later joined keep
+// apart.
+func (p PSVariables) generateShortNames(prefix string) {
+	used := make(map[string]bool)
+	for k := range reservedPSVariables {
+		used[k] = true
+	}
+	for i := range p {
+		used[strings.ToUpper(p[i].OriginalName)] = true
+	}
+
+	var nameIter int
+	for i := 0; i < len(p); i++ {
+		if p[i].Reserved {
+			continue
+		}
+
+		var s string
+		for s == "" || used[strings.ToUpper(s)] {
+			s = "$" + prefix + shortName(nameIter)
+			nameIter++
+		}
+
+		p[i].ShortName = s
+		used[strings.ToUpper(s)] = true
+	}
+}
+
+// checkShortNames returns an error naming the variables involved if any two
+// variables would be renamed to the same name, ignoring case as PowerShell
+// does, or if any would be renamed to the name of a variable that is kept.
+func (p PSVariables) checkShortNames() error {
+	kept := make(map[string]bool)
+	for k := range reservedPSVariables {
+		kept[k] = true
+	}
+	for i := range p {
+		if p[i].Reserved {
+			kept[strings.ToUpper(p[i].OriginalName)] = true
+		}
+	}
+
+	renamed := make(map[string]string)
+	for i := range p {
+		if p[i].Reserved {
+			continue
+		}
+
+		s := strings.ToUpper(p[i].ShortName)
+		if kept[s] {
+			return newError(ErrRenameCollision, "%s: %s would be renamed to %s which is kept", ErrRenameCollision, p[i].OriginalName, p[i].ShortName)
+		}
+		if other, ok := renamed[s]; ok {
+			return newError(ErrRenameCollision, "%s: %s and %s would both be renamed to %s", ErrRenameCollision, other, p[i].OriginalName, p[i].ShortName)
+		}
+		renamed[s] = p[i].OriginalName
+	}
+
+	return nil
+}
+
+// shortenVariables shorts all variables found in lines. Each of the two
+// replacements through lines is reported as half of the progress. The new
+// names are checked before any are replaced.
+func (p PSVariables) shortenVariables(lines []string, prefix string, report progressFunc) error {
+	// p.print()
+	if err := p.assignUniqueRandomNames(); err != nil {
+		return err
+	}
+	// p.print()
+	p.generateShortNames(prefix)
+	if err := p.checkShortNames(); err != nil {
+		return err
+	}
+	// p.print()
+	p.replaceVariablesWithUnique(lines, func(done int) { report.report(done / 2) })
+	p.replaceUniqueWithShort(lines, func(done int) { report.report((len(lines) + done) / 2) })
+
+	return nil
+}
+
+func (p PSVariables) print() {
+	for i := range p {
+
+		fmt.Printf("%s => %s => %s\n", p[i].OriginalName, p[i].UniqueName, p[i].ShortName)
+		fmt.Printf("   |%s\n", p[i].SourceLine)
+	}
+}
+
+// PSVariablesNameMod allows sorting based on original name length. Names of
+// the same length are sorted by name so the order, and with it the new name
+// each variable is given, is the same on every run.
+type PSVariablesNameMod PSVariables
+
+func (p PSVariablesNameMod) Len() int      { return len(p) }
+func (p PSVariablesNameMod) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+func (p PSVariablesNameMod) Less(i, j int) bool {
+	if len(p[i].OriginalName) != len(p[j].OriginalName) {
+		return len(p[i].OriginalName) > len(p[j].OriginalName)
+	}
+	return p[i].OriginalName < p[j].OriginalName
+}
+
+// ReadLines reads every line of the file at filePath returning them along
+// with the size of the file in bytes, new lines included.
+func ReadLines(filePath string) ([]string, int, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	lines, err := ReadLinesFrom(f)
+	return lines, int(info.Size()), err
+}
+
+// ReadLinesFrom reads every line from r without its line ending, \n or
+// \r\n. Lines of any length are read, such as a script already minimized
+// onto a single line.
+func ReadLinesFrom(r io.Reader) ([]string, error) {
+	var lines = make([]string, 0, 0)
+
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			lines = append(lines, strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"))
+		}
+		if err == io.EOF {
+			return lines, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// DetectLineEnding returns the line ending of the first line of data, \r\n
+// if it uses CRLF or \n otherwise.
+func DetectLineEnding(data []byte) string {
+	if i := bytes.IndexByte(data, '\n'); i > 0 && data[i-1] == '\r' {
+		return "\r\n"
+	}
+	return "\n"
+}
+
+// ReadLineEnding returns the line ending of the first line of the file at
+// filePath as DetectLineEnding does.
+func ReadLineEnding(filePath string) (string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	line, err := bufio.NewReader(f).ReadBytes('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	return DetectLineEnding(line), nil
+}
+
+// PercentReduced returns the percentage of before that was removed to get
+// to after.
+func PercentReduced(before int, after int) float64 {
+	if before == 0 {
+		return 0
+	}
+	return 100 - (float64(after) / float64(before) * 100)
+}
+
+// GetLength returns the number of bytes within lines. Lines that have been
+// minimized carry their own separators so this is their length as written.
+func GetLength(lines []string) int {
+	l := 0
+	for i := range lines {
+		l += len(lines[i])
+	}
+
+	return l
+}
+
+// SaveToFile writes lines to the file at filePath replacing any content it
+// had. An empty filePath or - writes them to stdout instead.
+func SaveToFile(lines []string, filePath string, log LogFunc) error {
+	if IsStdout(filePath) {
+		return writeLines(os.Stdout, lines)
+	}
+	log.logf(LogSummary, "saving to: %s", filePath)
+
+	f, err := os.Create(filePath)
+	if err != nil {
+		return newError(ErrWrite, "%s: %s", ErrWrite, err)
+	}
+	defer f.Close()
+
+	return writeLines(f, lines)
+}
+
+// writeLines writes every line to w as it is.
+func writeLines(w io.Writer, lines []string) error {
+	for i := range lines {
+		if _, err := io.WriteString(w, lines[i]); err != nil {
+			return newError(ErrWrite, "%s: %s", ErrWrite, err)
+		}
+	}
+
+	return nil
+}
+
+// ValidNamePrefix returns true if prefix can start the name of a variable,
+// as needed of Options.NamePrefix.
+func ValidNamePrefix(prefix string) bool {
+	return prefix == "" || psNameReg.MatchString(prefix)
+}
+
+// IsStdout returns true if the output path means the output is written to
+// stdout rather than a file.
+func IsStdout(filePath string) bool {
+	return filePath == "" || filePath == "-"
+}
+
+// stripAllComments strips any comments form all lines in the slice and
+// stores the result back into place.
+func stripAllComments(lines []string, report progressFunc) {
+	var state lexState
+	for i := range lines {
+		lines[i] = stripComments(lines[i], &state)
+		report.report(i + 1)
+	}
+}
+
+// stripComments removes any comments from the line and returns the line
+// with the comments stripped. Line comments, block comments and escaped #
+// characters are told apart by the lexer so a # within a string or
+// here-string is never taken as a comment. Block comments do not nest, the
+// first #> closes one. The state holds any block comment, string or
+// here-string left open by the previous line and is left as it is at the end
+// of this line.
+func stripComments(line string, state *lexState) string {
+	var minLine strings.Builder
+	segs := state.scan(line)
+	for i, seg := range segs {
+		if !seg.Comment {
+			minLine.WriteString(seg.Text)
+			continue
+		}
+
+		// An inline block comment separates the tokens around it so a space
+		// is kept in its place when there is nothing else between them.
+		if i > 0 && i+1 < len(segs) && !strings.HasSuffix(minLine.String(), " ") && !strings.HasSuffix(minLine.String(), "\t") &&
+			!strings.HasPrefix(segs[i+1].Text, " ") && !strings.HasPrefix(segs[i+1].Text, "\t") {
+			minLine.WriteByte(' ')
+		}
+	}
+
+	return minLine.String()
+}
+
+// shortenAllVariableNames shortens all the variable names to the minimum
+// characters possible. Any variable found in reserved, or used fewer than
+// minCount times, is left as is. The variables found are returned with their
+// new names, each starting with prefix.
+func shortenAllVariableNames(lines []string, reserved map[string]string, prefix string, minCount int, report progressFunc) (PSVariables, error) {
+	// Retrieving all variables and their counts.
+	psVars := getVariables(lines, reserved)
+	for i := range psVars {
+		if psVars[i].Count < minCount {
+			psVars[i].Reserved = true
+			psVars[i].ShortName = psVars[i].OriginalName
+		}
+	}
+	if err := psVars.shortenVariables(lines, prefix, report); err != nil {
+		return nil, err
+	}
+
+	return psVars, nil
+}
+
+// getVariables retrieves all the variables found in lines along with the
+// count. Variables found in reserved are marked as reserved along with the
+// built in reserved variables.
+//
+// Scopes are not tracked, every use of a name anywhere in lines is treated as
+// the same variable. A $x within a script block and a $x outside of it are
+// therefore renamed alike which keeps both working as each name still maps to
+// a single new name.
+func getVariables(lines []string, reserved map[string]string) PSVariables {
+	var psVars PSVariables
+	var psVarMap = make(map[string]int)
+	var psVarSource = make(map[string]string)
+
+	for i, refs := range findScriptVariables(lines) {
+		for _, v := range refs {
+			varName := v.Key
+
+			psVarMap[varName]++
+			if psVarMap[varName] == 1 {
+				psVarSource[varName] = lines[i]
+			}
+		}
+	}
+
+	// Counting splatted variables such as @params as uses of $params so
+	// they are renamed along with it.
+	for i, refs := range findScriptSplats(lines) {
+		for _, v := range refs {
+			varName := v.Key
+			psVarMap[varName]++
+			if psVarMap[varName] == 1 {
+				psVarSource[varName] = lines[i]
+			}
+		}
+	}
+	named := getNamedArguments(lines)
+	byName := getVariableCmdletNames(lines)
+
+	// A variable reached through the variable drive, such as
+	// $variable:name, is the variable of that name.
+	for k := range psVarMap {
+		if strings.HasPrefix(k, "$VARIABLE:") {
+			byName = append(byName, k[len("$VARIABLE:"):])
+		}
+	}
+	for k, v := range psVarMap {
+		p := PSVariable{OriginalName: k, Count: v, SourceLine: psVarSource[k]}
+		// Adding any reserved. A variable sharing its name with a named
+		// argument is likely a parameter and renaming it would break callers.
+		_, ok := reservedPSVariables[k]
+		_, extra := reserved[k]
+		if ok || extra || named[k] || matchesAny(byName, k[1:]) {
+			p.Reserved = true
+			p.ShortName = p.OriginalName
+		}
+
+		// Making sure we don't replace any escaped sequencing, numbered
+		// match group, such as the $1 of a -replace, or variable of a drive,
+		// such as $env:PATH, by marking as reserved.
+		if string(k[0]) == "`" || isMatchGroup(k) || strings.Contains(k, ":") {
+			p.Reserved = true
+			p.ShortName = p.OriginalName
+		}
+
+		psVars = append(psVars, p)
+	}
+
+	sort.Sort(PSVariablesNameMod(psVars))
+
+	return psVars
+}
+
+// psVarRef is a variable found within a line.
+type psVarRef struct {
+	// Key identifies the variable such as $NAME. A variable of the global,
+	// script, local, private or using scope is the same variable as the name
+	// without it. A variable of any other drive, such as $env:PATH, keeps
+	// the drive in its key. An escaped variable starts with a backtick.
+	Key string
+
+	// NameStart and NameEnd locate the name within the line, without any
+	// $, scope or braces.
+	NameStart int
+	NameEnd   int
+}
+
+// findScriptVariables returns the variables of each of lines as
+// findVariables does, leaving out any within a verbatim string, such as
+// '$x', where the $ is only text.
+func findScriptVariables(lines []string) [][]psVarRef {
+	return findInSegments(lines, func(seg segment) bool { return !seg.Verbatim }, findVariables)
+}
+
+// findScriptSplats returns the splatted variables of each of lines, such as
+// @params, keyed as the variable they splat. Only code is searched as an @
+// within any string or comment is only text.
+func findScriptSplats(lines []string) [][]psVarRef {
+	return findInSegments(lines, func(seg segment) bool { return !seg.Quoted && !seg.Comment }, findSplats)
+}
+
+// findInSegments returns what find returns for every segment of each of
+// lines that search accepts, located within the whole line.
+func findInSegments(lines []string, search func(seg segment) bool, find func(text string) []psVarRef) [][]psVarRef {
+	refs := make([][]psVarRef, len(lines))
+	var state lexState
+	for i := range lines {
+		var offset int
+		for _, seg := range state.scan(lines[i]) {
+			if search(seg) {
+				for _, v := range find(seg.Text) {
+					v.NameStart += offset
+					v.NameEnd += offset
+					refs[i] = append(refs[i], v)
+				}
+			}
+			offset += len(seg.Text)
+		}
+	}
+
+	return refs
+}
+
+// findSplats returns every splatted variable in line keyed as the variable
+// it splats, such as $PARAMS for @params.
+func findSplats(line string) []psVarRef {
+	var refs []psVarRef
+	for _, m := range psSplatReg.FindAllStringSubmatchIndex(line, -1) {
+		refs = append(refs, psVarRef{Key: "$" + strings.ToUpper(line[m[4]:m[5]]), NameStart: m[4], NameEnd: m[5]})
+	}
+
+	return refs
+}
+
+// findVariables returns every variable in line, as $name, $scope:name,
+// ${name} or ${scope:name}. A variable escaped with a backtick is returned
+// with it in its key while a backtick that is itself escaped by another is
+// left out as the variable is real. A ${} variable holding anything but a
+// simple name is skipped as it is never renamed.
+func findVariables(line string) []psVarRef {
+	var refs []psVarRef
+	for _, m := range psVarReg.FindAllStringSubmatchIndex(line, -1) {
+		var escaped bool
+		if line[m[0]] == charEscape {
+			var n int
+			for j := m[0] - 1; j >= 0 && line[j] == charEscape; j-- {
+				n++
+			}
+			escaped = n%2 == 0
+		}
+
+		var scope string
+		var ref psVarRef
+		if m[2] >= 0 {
+			ref.NameStart, ref.NameEnd = m[2], m[3]
+			if c := strings.IndexByte(line[m[2]:m[3]], ':'); c >= 0 {
+				scope = line[m[2] : m[2]+c]
+				ref.NameStart += c + 1
+			}
+			if !psNameReg.MatchString(line[ref.NameStart:ref.NameEnd]) {
+				continue
+			}
+		} else {
+			ref.NameStart, ref.NameEnd = m[6], m[7]
+			if m[4] >= 0 {
+				scope = line[m[4]:m[5]]
+			}
+		}
+
+		ref.Key = "$" + strings.ToUpper(line[ref.NameStart:ref.NameEnd])
+		if scope != "" && !isScope(scope) {
+			ref.Key = "$" + strings.ToUpper(scope) + ":" + ref.Key[1:]
+		}
+		if escaped {
+			ref.Key = "`" + ref.Key
+		}
+		refs = append(refs, ref)
+	}
+
+	return refs
+}
+
+// isScope returns true if name is a scope modifier rather than a drive.
+func isScope(name string) bool {
+	switch strings.ToLower(name) {
+	case "global", "script", "local", "private", "using":
+		return true
+	}
+	return false
+}
+
+// getNamedArguments returns the set of variable names, such as $PATH for
+// -Path, matching any named argument passed in lines.
+func getNamedArguments(lines []string) map[string]bool {
+	named := make(map[string]bool)
+	for i := range lines {
+		for _, r := range psNamedArgReg.FindAllStringSubmatch(lines[i], -1) {
+			named["$"+strings.ToUpper(r[2])] = true
+		}
+	}
+
+	return named
+}
+
+// getVariableCmdletNames returns the names, in upper case, that variables
+// are reached by as strings in lines through Get-Variable, Set-Variable,
+// Remove-Variable, Clear-Variable, New-Variable or their aliases. The name is
+// the value of -Name or the first positional argument and may be a comma
+// separated list or hold wildcards.
+func getVariableCmdletNames(lines []string) []string {
+	var names []string
+	for i := range lines {
+		for _, r := range psVarCmdletReg.FindAllStringSubmatch(lines[i], -1) {
+			args := strings.Fields(r[1])
+			for j := 0; j < len(args); j++ {
+				if !strings.HasPrefix(args[j], "-") {
+					names = append(names, splitNames(listArg(args[j:]))...)
+					break
+				}
+
+				param := strings.ToLower(strings.TrimRight(args[j][1:], ":"))
+				switch {
+				case param != "" && strings.HasPrefix("name", param):
+					names = append(names, splitNames(listArg(args[j+1:]))...)
+					j = len(args)
+				case psVarCmdletValueParams[param]:
+					j++
+				}
+			}
+		}
+	}
+
+	return names
+}
+
+// listArg returns the first argument of args joined with those following it
+// while it ends with a comma, as a list such as a, b is split by spaces.
+func listArg(args []string) string {
+	var arg string
+	for i := range args {
+		arg += args[i]
+		if !strings.HasSuffix(args[i], ",") {
+			break
+		}
+	}
+	return arg
+}
+
+// splitNames splits a comma separated list of names, quoted or not, into
+// each name in upper case.
+func splitNames(arg string) []string {
+	var names []string
+	for _, n := range strings.Split(arg, ",") {
+		if n = strings.Trim(n, "\"'()"); n != "" {
+			names = append(names, strings.ToUpper(n))
+		}
+	}
+	return names
+}
+
+// matchesAny returns true if name matches any of the patterns ignoring case.
+func matchesAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, strings.ToUpper(name)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// isMatchGroup returns true if name is a $ followed only by digits, as a
+// regular expression match group is referenced.
+func isMatchGroup(name string) bool {
+	if len(name) < 2 || name[0] != '$' {
+		return false
+	}
+	for i := 1; i < len(name); i++ {
+		if name[i] < '0' || name[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// getNextShortname returns the next shortname to use. Use 0 for the first call.
+func getNextShortName(lastName byte) byte {
+	if lastName == 0 {
+		return 65
+	}
+
+	// Get the next character.
+	lastName++
+
+	// Skip special characters
+	if lastName == 91 {
+		return 97
+	}
+
+	if lastName > 172 {
+
+	}
+
+	return lastName
+
+}
+
+// removeExtraSpaces removes any extra spaces around various powershell
+// operators other than those in keep. The space after a - is only removed
+// if minus is set. Spaces within strings are left untouched.
+func removeExtraSpaces(lines []string, keep map[string]bool, minus bool, report progressFunc) {
+	var state lexState
+	for i := range lines {
+		var l strings.Builder
+		for j, seg := range state.scan(lines[i]) {
+			if seg.Quoted || seg.Comment {
+				l.WriteString(seg.Text)
+				continue
+			}
+
+			// Indentation is left for the newlines pass to decide on.
+			if j == 0 {
+				rest := strings.TrimLeftFunc(seg.Text, unicode.IsSpace)
+				l.WriteString(seg.Text[:len(seg.Text)-len(rest)])
+				seg.Text = rest
+			}
+			l.WriteString(collapseSpaces(seg.Text, keep, minus))
+		}
+		lines[i] = l.String()
+		report.report(i + 1)
+	}
+}
+
+// collapseSpaces removes any extra spaces around various powershell
+// operators found in s. The spaces around any operator in keep are left, as
+// is the space after a - unless minus is set.
+func collapseSpaces(s string, keep map[string]bool, minus bool) string {
+	// collapse replaces old with new unless op is kept.
+	collapse := func(op string, old string, new string) {
+		if !keep[op] {
+			s = strings.Replace(s, old, new, -1)
+		}
+	}
+
+	// Compound assignment operators are handled as a whole before their
+	// individual characters are.
+	for _, op := range []string{"+=", "-=", "*=", "/=", "%="} {
+		collapse(op, " "+op, op)
+		collapse(op, op+" ", op)
+	}
+
+	// fmt.Println(s)
+	collapse("=", " =", "=")
+	// fmt.Println(s)
+	collapse("=", "= ", "=")
+	collapse("+", " +", "+")
+	collapse("+", "+ ", "+")
+	// A - followed by a space is left alone by default as $x - 1 is a
+	// subtraction while $x -1 passes -1 to a command.
+	if minus {
+		collapse("-", "- ", "-")
+	}
+	collapse("*", " *", "*")
+	collapse("*", "* ", "*")
+	s = collapseComparisons(s, keep)
+	collapse("/", " /", "/")
+	collapse("/", "/ ", "/")
+
+	collapse("(", "( ", "(")
+	collapse("(", " (", "(")
+	collapse(")", " )", ")")
+	collapse(")", ") ", ")")
+
+	collapse("[", "[ ", "[")
+	collapse("[", " [", "[")
+	collapse("]", " ]", "]")
+	// A space before a - is kept as the - may start a parameter, such as
+	// the -Path of Get-Item $paths[0] -Path, which would otherwise become
+	// part of the argument.
+	if !keep["]"] {
+		s = psBracketSpaceReg.ReplaceAllString(s, "]$1")
+	}
+
+	collapse("{", "{ ", "{")
+	collapse("{", " {", "{")
+	collapse("}", " }", "}")
+	if !keep["}"] {
+		s = collapseBraceSpaces(s)
+	}
+
+	collapse(";", "; ", ";")
+	collapse(";", " ;", ";")
+
+	collapse(",", ", ", ",")
+	collapse(",", " ,", ",")
+
+	return s
+}
+
+// collapseBraceSpaces removes the space after every closing brace in s other
+// than that of a ${name}, as the space may separate the variable from the
+// next argument such as in Write-Host ${a} $b.
+func collapseBraceSpaces(s string) string {
+	braced := make(map[int]bool)
+	for _, m := range psVarReg.FindAllStringSubmatchIndex(s, -1) {
+		if m[2] >= 0 {
+			braced[m[1]-1] = true
+		}
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		b.WriteByte(s[i])
+		if s[i] == '}' && !braced[i] && i+1 < len(s) && s[i+1] == ' ' {
+			i++
+		}
+	}
+	return b.String()
+}
+
+// collapseComparisons removes the spaces around every comparison operator in
+// s other than those in keep. The space after one is kept when a word
+// follows as -eq1 would be read as a single token.
+func collapseComparisons(s string, keep map[string]bool) string {
+	var b strings.Builder
+	var last int
+	for _, m := range psComparisonReg.FindAllStringSubmatchIndex(s, -1) {
+		op := s[m[2]:m[3]]
+		b.WriteString(s[last:m[0]])
+		last = m[1]
+		if keep[strings.ToLower(op)] {
+			b.WriteString(s[m[0]:m[1]])
+			continue
+		}
+		b.WriteString(op)
+		if m[3] < m[1] && m[1] < len(s) && isWordByte(s[m[1]]) {
+			b.WriteByte(' ')
+		}
+	}
+	b.WriteString(s[last:])
+
+	return b.String()
+}
+
+// keepNewLines trims every line while keeping each on a line of its own.
+// Empty lines are removed unless keepBlank is set in which case every run of
+// them is collapsed into a single empty line. Lines left empty once comments
+// are stripped count as empty. Each line is then indented by indent once for
+// every bracket left open before it, less any it starts by closing.
+func keepNewLines(lines []string, keepBlank bool, indent string, report progressFunc) []string {
+	minimizedLines := make([]string, 0, len(lines))
+	var state lexState
+	var blank bool
+
+	for i := range lines {
+		report.report(i)
+
+		// Whitespace within a string is kept as with removeAllNewLines.
+		startOpen := state.inString()
+		inComment := state.comment
+		depth := len(state.stack)
+		state.scan(lines[i])
+
+		l := lines[i]
+		if !startOpen {
+			l = strings.TrimLeftFunc(l, unicode.IsSpace)
+		}
+		if !state.inString() {
+			l = strings.TrimRightFunc(l, unicode.IsSpace)
+		}
+
+		if l == "" && !startOpen {
+			blank = true
+			continue
+		}
+		if blank && keepBlank && len(minimizedLines) > 0 {
+			minimizedLines = append(minimizedLines, "\n")
+		}
+		blank = false
+
+		if indent != "" && !startOpen && !inComment {
+			for j := 0; j < len(l) && depth > 0 && strings.IndexByte("})]", l[j]) >= 0; j++ {
+				depth--
+			}
+			l = strings.Repeat(indent, depth) + l
+		}
+		minimizedLines = append(minimizedLines, l+"\n")
+	}
+
+	return minimizedLines
+}
+
+// normalizeLineEndings returns lines with eol written after each and
+// nothing else changed.
+func normalizeLineEndings(lines []string, eol string) []string {
+	normalized := make([]string, len(lines))
+	for i := range lines {
+		normalized[i] = lines[i] + eol
+	}
+
+	return normalized
+}
+
+// stripBlankLines removes every empty or whitespace only line leaving all
+// other lines exactly as they are. Lines within a string or here-string are
+// part of its value and are always kept.
+func stripBlankLines(lines []string) []string {
+	minimizedLines := make([]string, 0, len(lines))
+	var state lexState
+
+	for i := range lines {
+		startOpen := state.inString()
+		state.scan(lines[i])
+
+		if !startOpen && strings.TrimSpace(lines[i]) == "" {
+			continue
+		}
+		minimizedLines = append(minimizedLines, lines[i]+"\n")
+	}
+
+	return minimizedLines
+}
+
+// keepStructure keeps every statement nested within fewer than depth braces
+// on a line of its own, along with what is left of its indentation, while
+// joining the lines of anything nested deeper onto the line they belong to
+// as removeAllNewLines does. A new line is only started where no string,
+// parenthesis or square bracket is left open.
+func keepStructure(lines []string, depth int, report progressFunc, log LogFunc) []string {
+	minimizedLines := make([]string, 0, len(lines))
+	var state lexState
+
+	var start int
+	var continued bool
+	flush := func(end int) {
+		joined := strings.Join(removeAllNewLines(lines[start:end], nil, log), "")
+		// The new line ends the statement so no semicolon is needed.
+		joined = strings.TrimRight(joined, ";\n")
+		if joined != "" {
+			indent := lines[start][:len(lines[start])-len(strings.TrimLeftFunc(lines[start], unicode.IsSpace))]
+			minimizedLines = append(minimizedLines, indent+joined+"\n")
+		}
+		start = end
+	}
+
+	for i := range lines {
+		report.report(i)
+
+		var braces int
+		clean := !state.inString() && !state.comment
+		for _, c := range state.stack {
+			if c != '{' {
+				clean = false
+			}
+			braces++
+		}
+		if i > start && clean && braces < depth && !continued {
+			flush(i)
+		}
+
+		continued = continues(state.scan(lines[i]))
+	}
+	flush(len(lines))
+
+	return minimizedLines
+}
+
+// continues returns true if the line scanned into segs ends in a backtick
+// continuing it on the next line. A backtick escaped by another is not one.
+func continues(segs []segment) bool {
+	if len(segs) == 0 || segs[len(segs)-1].Quoted || segs[len(segs)-1].Comment {
+		return false
+	}
+	text := strings.TrimRightFunc(segs[len(segs)-1].Text, unicode.IsSpace)
+	ticks := len(text) - len(strings.TrimRight(text, "`"))
+	return ticks%2 == 1
+}
+
+// endsInComment returns true if the line scanned into segs ends in a line
+// comment. startComment is whether a block comment was open at the start of
+// the line, making its first segment the end of that comment instead.
+func endsInComment(segs []segment, startComment bool) bool {
+	if len(segs) == 0 {
+		return false
+	}
+	last := segs[len(segs)-1]
+	if !last.Comment || strings.HasPrefix(last.Text, "<#") {
+		return false
+	}
+	return len(segs) > 1 || !startComment
+}
+
+// removeAllNewLines removes all new lines that adding semicolons as needed.
+func removeAllNewLines(lines []string, report progressFunc, log LogFunc) []string {
+	minimizedLines := make([]string, 0, len(lines))
+	var state lexState
+
+	for i := range lines {
+		report.report(i)
+
+		// A line starting or ending within a string keeps the whitespace and
+		// new line on that side as they are part of the string.
+		startOpen, startComment := state.inString(), state.comment
+		segs := state.scan(lines[i])
+
+		l := lines[i]
+		if !startOpen {
+			l = strings.TrimLeftFunc(l, unicode.IsSpace)
+		}
+		if state.inString() {
+			log.logf(LogLines, "newlines: line %d ends within a string, new line kept", i+1)
+			minimizedLines = append(minimizedLines, l+"\n")
+			continue
+		}
+
+		// Everything after a --% is passed to the command up to the end of
+		// the line so nothing can follow it on the same line.
+		if state.literal {
+			log.logf(LogLines, "newlines: line %d ends after --%%, new line kept", i+1)
+			minimizedLines = append(minimizedLines, l+"\n")
+			continue
+		}
+		l = strings.TrimRightFunc(l, unicode.IsSpace)
+
+		// A comment runs to the end of the line, which is only there when
+		// the comments pass was disabled, so anything joined after it would
+		// become part of it.
+		if endsInComment(segs, startComment) {
+			log.logf(LogLines, "newlines: line %d ends in a comment, new line kept", i+1)
+			minimizedLines = append(minimizedLines, l+"\n")
+			continue
+		}
+
+		// skip empty lines
+		if l == "" {
+			log.logf(LogLines, "newlines: line %d is empty, removed", i+1)
+			continue
+		}
+
+		// A backtick at the end of the line continues the statement on the
+		// next so it is dropped and the lines joined with a space instead.
+		if continues(segs) {
+			l = strings.TrimRightFunc(l[:len(l)-1], unicode.IsSpace) + " "
+			log.logf(LogLines, "newlines: line %d continues, joined as %q", i+1, l)
+			minimizedLines = append(minimizedLines, l)
+			continue
+		}
+
+		// Within parentheses or square brackets there is a single expression
+		// so the lines are joined without a semicolon, only keeping a space
+		// where the two lines would otherwise run together.
+		if top := state.top(); top == '(' || top == '[' {
+			if !strings.ContainsRune("([{,", rune(l[len(l)-1])) && !strings.ContainsRune(")]},", rune(nextLineStart(lines, i))) {
+				l = l + " "
+			}
+			log.logf(LogLines, "newlines: line %d joined as %q", i+1, l)
+			minimizedLines = append(minimizedLines, l)
+			continue
+		}
+
+		// The last statement before a block, hashtable or subexpression is
+		// closed needs no semicolon as the closing bracket ends it.
+		next := nextLineStart(lines, i)
+		closing := (state.top() == '$' && next == ')') || (state.top() == '{' && next == '}')
+
+		switch strings.ToUpper(l[len(l)-1:]) {
+		// switch lines[i][len(lines[i])-1:] {
+		case "{", "(", ";", "|":
+			// The statement goes on with the next line, such as the next
+			// command of a pipeline.
+
+		case "]":
+			// An attribute such as [CmdletBinding()] on a line of its own
+			// goes with the param block, or the attributes, after it.
+			if !(psAttributeReg.MatchString(l) && (next == '[' || firstWord(nextLine(lines, i)) == "param")) {
+				l = l + "\n"
+			}
+		case ",":
+			// nothing is needed for these.
+		default:
+			// Anything else ends the statement, including a bare return,
+			// break, continue, exit or throw and those given a value. That
+			// is unless the statement goes on with the next line, a catch,
+			// finally or else after the block closed here or the block of
+			// a keyword starting on a line of its own. A while or until may
+			// end a do loop and a block may be an argument so neither can
+			// be joined but the new line is kept instead.
+			word := firstWord(strings.TrimLeft(l, "} "))
+			nextWord := firstWord(nextLine(lines, i))
+			switch {
+			case closing:
+			case next == '(' && psParamEndReg.MatchString(l):
+				// The param block opens on the next line.
+			case psOperatorEndReg.MatchString(l):
+				// The expression goes on with the operand on the next line.
+				l = l + " "
+			case strings.HasSuffix(l, "}") && psContinuationKeywords[nextWord]:
+			case next == '{' && psBlockKeywords[word]:
+			case next == '{' || (strings.HasSuffix(l, "}") && (nextWord == "while" || nextWord == "until")):
+				l = l + "\n"
+			default:
+				l = l + ";"
+			}
+		}
+		log.logf(LogLines, "newlines: line %d joined as %q", i+1, l)
+		minimizedLines = append(minimizedLines, l)
+
+	}
+
+	return minimizedLines
+
+}
+
+// collapseSemicolons removes every semicolon outside of strings that follows
+// another, ignoring whitespace, or that comes before any statement, as each
+// only ends an empty statement. Those within parentheses are kept as they
+// separate the parts of a for loop. The lines are read as one text so runs
+// split across lines are found too.
+func collapseSemicolons(lines []string) []string {
+	var state lexState
+	var depth int
+	var prev byte
+
+	for i := range lines {
+		var l strings.Builder
+		l.Grow(len(lines[i]))
+		for _, seg := range state.scan(lines[i]) {
+			if seg.Quoted || seg.Comment {
+				l.WriteString(seg.Text)
+				prev = '"'
+				continue
+			}
+
+			for j := 0; j < len(seg.Text); j++ {
+				c := seg.Text[j]
+				switch c {
+				case '(':
+					depth++
+				case ')':
+					depth--
+				case ';':
+					if depth <= 0 && (prev == 0 || prev == ';') {
+						continue
+					}
+				}
+				if !unicode.IsSpace(rune(c)) {
+					prev = c
+				}
+				l.WriteByte(c)
+			}
+		}
+		lines[i] = l.String()
+	}
+
+	return lines
+}
+
+// nextLineStart returns the first character of the next line after i that
+// is not empty or 0 if there is none.
+func nextLineStart(lines []string, i int) byte {
+	if l := nextLine(lines, i); l != "" {
+		return l[0]
+	}
+	return 0
+}
+
+// nextLine returns the next line after i that is not empty with its
+// whitespace trimmed or an empty string if there is none.
+func nextLine(lines []string, i int) string {
+	for j := i + 1; j < len(lines); j++ {
+		if l := strings.TrimSpace(lines[j]); l != "" {
+			return l
+		}
+	}
+	return ""
+}
+
+// firstWord returns the letters starting s in lower case.
+func firstWord(s string) string {
+	end := strings.IndexFunc(s, func(r rune) bool { return !unicode.IsLetter(r) })
+	if end < 0 {
+		end = len(s)
+	}
+	return strings.ToLower(s[:end])
+}
@@ -0,0 +1,380 @@
+package psminimize
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadLinesFrom(t *testing.T) {
+	long := "$x=" + strings.Repeat("1", 100*1024)
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{"lf", "a\nb\n", []string{"a", "b"}},
+		{"crlf", "a\r\nb\r\n", []string{"a", "b"}},
+		{"no final new line", "a\nb", []string{"a", "b"}},
+		{"blank lines", "a\n\n\nb", []string{"a", "", "", "b"}},
+		{"empty", "", []string{}},
+		{"long line", long + "\n" + long, []string{long, long}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadLinesFrom(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %d lines, want %d", len(got), len(tt.want))
+			}
+		})
+	}
+}
+
+// minimizeString minimizes script as Minimize does the lines of a file and
+// returns the output joined into one string.
+func minimizeString(t *testing.T, script string, opts Options) string {
+	t.Helper()
+	lines, err := Minimize(strings.Split(script, "\n"), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Join(lines, "")
+}
+
+func TestSplitJoinDelimiters(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   string
+	}{
+		{"split", "$parts = 'a, b' -split ', '\n$parts", "$A='a, b' -split ', ';$A;"},
+		{"join", "$parts = 1, 2\n$parts -join '; '", "$A=1,2;$A -join '; ';"},
+		{"regex", "$parts = 'a,  b'\n$parts -split \",\\s*\"", "$A='a,  b';$A -split \",\\s*\";"},
+		{"joined lines", "$s = 'x' -split\n',' -join ' '", "$A='x' -split ',' -join ' ';"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := minimizeString(t, tt.script, Options{}); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStripComments(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		want  []string
+	}{
+		{"hash alone", []string{"#", "$a"}, []string{"", "$a"}},
+		{"starts with hash", []string{"#$a = 1", "$a"}, []string{"", "$a"}},
+		{"ends with hash", []string{"$a = 1 #", "$a #"}, []string{"$a = 1 ", "$a "}},
+		{"block open at end", []string{"$a = 1 <#", "#>"}, []string{"$a = 1 ", ""}},
+		{"block close split", []string{"<# x #", "> y #>", "$a"}, []string{"", "", "$a"}},
+		{"block close split after code", []string{"$a = 1 <# x #", "> 2 #> $a"}, []string{"$a = 1 ", " $a"}},
+		{"hash in double quotes", []string{`$a = "# not" + "a#b"`}, []string{`$a = "# not" + "a#b"`}},
+		{"hash in single quotes", []string{`$a = '# not' + 'a#b'`}, []string{`$a = '# not' + 'a#b'`}},
+		{"comment after a string", []string{`$a = "x#" # real`, `$b = 'y#' # real`}, []string{`$a = "x#" `, `$b = 'y#' `}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var state lexState
+			for i, line := range tt.lines {
+				if got := stripComments(line, &state); got != tt.want[i] {
+					t.Errorf("line %d: got %q, want %q", i+1, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestPrefixNames(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   string
+	}{
+		{"shorter first", "$val = 1\n$value = 2\n$value2 = $val + $value + $value", "$C=1;$B=2;$A=$C+$B+$B;"},
+		{"longer first", "$value = 1\n$val = 2\n$v = $value + $val\n$valueX = $v", "$B=1;$C=2;$D=$B+$C;$A=$D;"},
+		{"braced", "$val = 1\n${value} = $val\n$value + $val", "$B=1;${A}=$B;$A+$B;"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := minimizeString(t, tt.script, Options{}); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestControlFlowKeywords(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   string
+	}{
+		{"exit", "if ($x) {\n  exit\n}\n$x", "if($A){exit};$A;"},
+		{"exit code", "if ($x) {\n  exit 1\n}\n$x", "if($A){exit 1};$A;"},
+		{"return", "if ($x) {\n  return\n}\n$x", "if($A){return};$A;"},
+		{"break and continue", "while ($x) {\n  break\n  continue\n}\n$x", "while($A){break;continue};$A;"},
+		{"throw", "if ($x) {\n  throw 'bad'\n}\n$x", "if($A){throw 'bad'};$A;"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := minimizeString(t, tt.script, Options{}); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPathStrings(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   string
+	}{
+		{"double quoted", "$p = \"C:\\temp\\\"\n$p", "$A=\"C:\\temp\\\";$A;"},
+		{"single quoted", "$p = 'C:\\temp\\'\n$p", "$A='C:\\temp\\';$A;"},
+		{"followed by code", "$p = \"C:\\temp\\\" # dir\n$q = $p + \"x\"\n$q", "$A=\"C:\\temp\\\";$B=$A+\"x\";$B;"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := minimizeString(t, tt.script, Options{}); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScopedBracedVariables(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   string
+	}{
+		{"braced first", "${script:config} = 1\n$script:config + ${script:config}", "${script:A}=1;$script:A+${script:A};"},
+		{"plain first", "$script:config = 1\n${script:config} + $config", "$script:A=1;${script:A}+$A;"},
+		{"arguments", "$script:config = 1\nWrite-Host ${script:config} $script:config", "$script:A=1;Write-Host ${script:A} $script:A;"},
+		{"drive", "${env:Path} + $env:Path", "${env:Path}+$env:Path;"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := minimizeString(t, tt.script, Options{}); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubexpressionInString(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   string
+	}{
+		{"spanning lines", "$s = \"total: $(\n  $n + 1\n) items  here\"\n$n", "$B=\"total: $(\n  $A+1\n) items  here\";$A;"},
+		{"nested string", "$s = \"a $(\n  \"b  $(\n    'c'\n  )\"\n)  d\"\n$s", "$A=\"a $(\n  \"b  $(\n    'c'\n  )\"\n)  d\";$A;"},
+		{"comment", "$s = \"a $(\n  'b' # c\n)\"\n$s", "$A=\"a $(\n  'b' \n)\";$A;"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := minimizeString(t, tt.script, Options{}); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestXMLHereString(t *testing.T) {
+	script := "$xml = @\"\n<Types>\n  <!-- a # comment -->\n  <Type>  <Name>x</Name>  </Type>\n  <!--\n  <# not a comment #>\n  -->\n</Types>\n\"@\n$xml"
+	want := "$A=@\"\n<Types>\n  <!-- a # comment -->\n  <Type>  <Name>x</Name>  </Type>\n  <!--\n  <# not a comment #>\n  -->\n</Types>\n\"@;$A;"
+	if got := minimizeString(t, script, Options{}); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestCompoundAssignment(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   string
+	}{
+		{"add", "$x = 1\n$x += 2", "$A=1;$A+=2;"},
+		{"subtract", "$x = 1\n$x -= 2", "$A=1;$A-=2;"},
+		{"multiply", "$x = 1\n$x *= 2", "$A=1;$A*=2;"},
+		{"divide", "$x = 1\n$x /= 2", "$A=1;$A/=2;"},
+		{"remainder", "$x = 1\n$x %= 2", "$A=1;$A%=2;"},
+		{"within a string", "$x = '$y -= 1'\n$x += \" a += b \"", "$A='$y -= 1';$A+=\" a += b \";"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := minimizeString(t, tt.script, Options{}); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubexpressionStatements(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   string
+	}{
+		{"array of values", "$list = @(\n  1,\n  2\n)\n$list", "$A=@(1,2);$A;"},
+		{"array of statements", "$list = @(\n  Get-Item 'a'\n  Get-Item 'b'\n)\n$list", "$A=@(Get-Item 'a';Get-Item 'b');$A;"},
+		{"array statement", "@(\n  'a'\n  'b'\n) | Write-Host", "@('a';'b') | Write-Host;"},
+		{"subexpression statement", "$(\n  $x = 1\n  $x\n)", "$($A=1;$A);"},
+		{"member of a subexpression", "$(Get-Date\n).Year", "$(Get-Date).Year;"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := minimizeString(t, tt.script, Options{}); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchVariables(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   string
+	}{
+		{"numbered groups", "if ('ab' -match '(a)(b)') {\n  $first = $1\n  $first + $2\n}", "if('ab' -match '(a)(b)'){$A=$1;$A+$2};"},
+		{"numbered group name", "$1 = 'x'\n$1 + $1", "$1='x';$1+$1;"},
+		{"matches", "if ($s -match '(\\d+)') {\n  $n = $matches[1]\n  $n + $Matches[0]\n}", "if($B -match '(\\d+)'){$A=$matches[1]\n$A+$Matches[0]\n};"},
+		{"matches assigned", "$matches = @{}\n$MATCHES.Count", "$matches=@{};$MATCHES.Count;"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := minimizeString(t, tt.script, Options{}); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShortNamesSkipSourceNames(t *testing.T) {
+	p := PSVariables{{OriginalName: "$A0", Reserved: true}, {OriginalName: "$b1"}}
+	for i := 0; i < 800; i++ {
+		p = append(p, PSVariable{OriginalName: fmt.Sprintf("$v%d", i)})
+	}
+	p.generateShortNames("")
+
+	seen := make(map[string]bool)
+	for _, v := range p {
+		name := strings.ToUpper(v.ShortName)
+		if v.Reserved {
+			continue
+		}
+		if name == "$A0" || name == "$B1" {
+			t.Errorf("%s renamed to %s, the name of a source variable", v.OriginalName, v.ShortName)
+		}
+		if seen[name] {
+			t.Errorf("%s renamed to %s, already given to another", v.OriginalName, v.ShortName)
+		}
+		seen[name] = true
+	}
+	if !seen["$C1"] {
+		t.Error("expected names past $B1 to be generated")
+	}
+}
+
+func TestMinimizeReproducible(t *testing.T) {
+	lines, _, err := ReadLines(filepath.Join("testdata", "corpus", "module.ps1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := Minimize(append([]string(nil), lines...), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		again, err := Minimize(append([]string(nil), lines...), Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := strings.Join(again, ""), strings.Join(first, ""); got != want {
+			t.Fatalf("run %d differs from the first at byte %d", i+2, firstDifference(got, want))
+		}
+	}
+}
+
+func TestReadLinesMissingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing.ps1")
+	_, _, err := ReadLines(path)
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected %q, got %v", os.ErrNotExist, err)
+	}
+	if !strings.Contains(err.Error(), path) {
+		t.Errorf("expected the error to name %s, got %q", path, err)
+	}
+}
+
+func TestLengthsMatchFiles(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name   string
+		script string
+		opts   Options
+	}{
+		{"lf", "$x = 1\n$x\n", Options{}},
+		{"crlf", "$x = 1\r\n$x\r\n", Options{LineEnding: "\r\n", KeepNewlines: true}},
+		{"no final new line", "$x = 1\n$x", Options{NoFinalNewline: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inPath := filepath.Join(dir, tt.name+".ps1")
+			if err := os.WriteFile(inPath, []byte(tt.script), 0644); err != nil {
+				t.Fatal(err)
+			}
+			lines, length, err := ReadLines(inPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if length != len(tt.script) {
+				t.Errorf("read %d bytes, the file holds %d", length, len(tt.script))
+			}
+
+			minimized, err := Minimize(lines, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			output := FinishOutput(minimized, tt.opts)
+			outPath := filepath.Join(dir, tt.name+".min.ps1")
+			if err := SaveToFile(output, outPath, nil); err != nil {
+				t.Fatal(err)
+			}
+			info, err := os.Stat(outPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if GetLength(output) != int(info.Size()) {
+				t.Errorf("measured %d bytes, wrote %d", GetLength(output), info.Size())
+			}
+		})
+	}
+}
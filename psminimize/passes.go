@@ -0,0 +1,459 @@
+package psminimize
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Options controls how a script is minimized.
+type Options struct {
+	// OnlyFunctions limits minimization to the bodies of the named
+	// functions when not empty.
+	OnlyFunctions []string
+
+	// ResolveDotSource reserves the variables a script shares with the
+	// scripts it dot-sources, or that dot-source it in directory mode.
+	ResolveDotSource bool
+
+	// TargetBytes minimizes only as many of the largest functions as needed
+	// for the output to be no larger than this when not zero.
+	TargetBytes int
+
+	// Reserved holds additional variable names that must not be renamed.
+	Reserved map[string]string
+
+	// ReservedNames holds variable names given by the user, such as $Path,
+	// that must not be renamed. Each matches the variable whatever its case
+	// unless ReservedCaseSensitive is set.
+	ReservedNames []string
+
+	// ReservedCaseSensitive matches ReservedNames only against variables
+	// spelled with the same case somewhere in the script. Every spelling of
+	// a matched variable still keeps its name as PowerShell treats them as
+	// one variable.
+	ReservedCaseSensitive bool
+
+	// Disabled holds the names of the passes that should not be run.
+	Disabled map[string]bool
+
+	// KeepNewlines keeps every line on its own instead of joining them.
+	KeepNewlines bool
+
+	// PreserveNewlines keeps every line on its own as KeepNewlines does and
+	// sets LineEnding to that of the script when it is read from a file.
+	PreserveNewlines bool
+
+	// KeepBlankLines keeps a single blank line wherever there were any when
+	// KeepNewlines or Reindent is set.
+	KeepBlankLines bool
+
+	// LineEnding, when set, is written in place of each new line the
+	// newlines pass keeps, such as \r\n to match a script using CRLF.
+	LineEnding string
+
+	// Reindent keeps every line on its own as KeepNewlines does, indenting
+	// each by two spaces for every bracket it is nested within.
+	Reindent bool
+
+	// KeepStructure keeps statements nested within fewer than this many
+	// braces on their own lines when KeepNewlines is not set. Zero joins
+	// every line.
+	KeepStructure int
+
+	// KeepPublicHelp keeps the comment based help of functions exported
+	// by the script while the rest of the comments are stripped.
+	KeepPublicHelp bool
+
+	// KeepSpacing is the set of operators the spaces pass leaves the spaces
+	// around as they are.
+	KeepSpacing map[string]bool
+
+	// CollapseMinus removes the space after a - as well, which is only safe
+	// for scripts that never pass a lone - or a negative number to a
+	// command.
+	CollapseMinus bool
+
+	// MinVarCount keeps the name of every variable used fewer than this many
+	// times, only renaming those where it saves the most.
+	MinVarCount int
+
+	// NamePrefix starts the new name of every renamed variable, keeping the
+	// names of scripts minimized apart and joined later from colliding.
+	NamePrefix string
+
+	// PreserveFirstLine writes the first line as it is, such as a shebang or
+	// a directive some tool requires, minimizing only the rest.
+	PreserveFirstLine bool
+
+	// BlankLinesOnly removes empty lines instead of running any of the
+	// passes.
+	BlankLinesOnly bool
+
+	// NormalizeEOL, when set, is written after every line instead of running
+	// any of the passes, leaving the script otherwise untouched.
+	NormalizeEOL string
+
+	// Header and Footer are written on lines of their own before and after
+	// the minimized script when it is saved.
+	Header string
+	Footer string
+
+	// SaveComments saves the comments stripped from the script to a file
+	// beside the output.
+	SaveComments bool
+
+	// NoGrow writes the original script instead of a minimized one that
+	// turned out larger, as GuardGrowth does.
+	NoGrow bool
+
+	// DryRun minimizes the script as usual without writing the output or
+	// the comments anywhere.
+	DryRun bool
+
+	// NoFinalNewline ends the saved output with no new line instead of
+	// exactly one.
+	NoFinalNewline bool
+
+	// Force minimizes the script even when it appears to be malformed.
+	Force bool
+
+	// AllowPartial writes what can be minimized safely instead of failing.
+	// The lines of a malformed script from where the problem starts are
+	// written as they are and a pass that fails is skipped, each with a
+	// warning.
+	AllowPartial bool
+
+	// Log is called with diagnostics about each pass when set.
+	Log LogFunc
+
+	// Progress is called as each pass works through the lines when set.
+	Progress func(pass string, done int, total int)
+
+	// Timing is called with the time each pass took to run when set.
+	Timing func(pass string, elapsed time.Duration)
+
+	// Report, when set, is given the variables found and any warnings.
+	Report *Report
+
+	// lineOffset is the number of lines before those being minimized, such
+	// as a preserved first line, added to the line numbers reported.
+	lineOffset int
+}
+
+// pass is a single minimization step run over the lines of a script.
+type pass struct {
+	Name string
+	Run  func(lines []string, opts Options, report progressFunc) ([]string, error)
+}
+
+// passes holds every minimization step in the order they are run.
+var passes = []pass{
+	{"comments", func(lines []string, opts Options, report progressFunc) ([]string, error) {
+		stripAllComments(lines, report)
+		return lines, nil
+	}},
+	{"variables", func(lines []string, opts Options, report progressFunc) ([]string, error) {
+		reserved := WithReserved(opts, matchReservedNames(lines, opts.ReservedNames, opts.ReservedCaseSensitive)).Reserved
+		psVars, err := shortenAllVariableNames(lines, reserved, opts.NamePrefix, opts.MinVarCount, report)
+		if err != nil {
+			return nil, err
+		}
+		if opts.Report != nil {
+			opts.Report.Variables = append(opts.Report.Variables, psVars...)
+		}
+		for i := range psVars {
+			if psVars[i].Reserved {
+				opts.Log.logf(LogVariables, "variables: %s is reserved (%d uses)", psVars[i].OriginalName, psVars[i].Count)
+				continue
+			}
+			opts.Log.logf(LogVariables, "variables: %s => %s (%d uses)", psVars[i].OriginalName, psVars[i].ShortName, psVars[i].Count)
+		}
+		return lines, nil
+	}},
+	{"spaces", func(lines []string, opts Options, report progressFunc) ([]string, error) {
+		removeExtraSpaces(lines, opts.KeepSpacing, opts.CollapseMinus, report)
+		return lines, nil
+	}},
+	{"newlines", func(lines []string, opts Options, report progressFunc) ([]string, error) {
+		switch {
+		case opts.KeepNewlines || opts.PreserveNewlines:
+			lines = keepNewLines(lines, opts.KeepBlankLines, "", report)
+		case opts.Reindent:
+			lines = keepNewLines(lines, opts.KeepBlankLines, reindentWidth, report)
+		case opts.KeepStructure > 0:
+			lines = keepStructure(lines, opts.KeepStructure, report, opts.Log)
+		default:
+			lines = removeAllNewLines(lines, report, opts.Log)
+		}
+		lines = collapseSemicolons(lines)
+		if opts.LineEnding != "" {
+			for i := range lines {
+				lines[i] = strings.Replace(lines[i], "\n", opts.LineEnding, -1)
+			}
+		}
+		return lines, nil
+	}},
+}
+
+// reindentWidth is the indentation written for each level of nesting when
+// reindenting.
+const reindentWidth = "  "
+
+// ParsePassNames parses the comma separated list of pass names into a set,
+// returning an error if any name is not a known pass.
+func ParsePassNames(list string) (map[string]bool, error) {
+	names := make(map[string]bool)
+	for _, n := range strings.Split(list, ",") {
+		n = strings.ToLower(strings.TrimSpace(n))
+		if n == "" {
+			continue
+		}
+
+		var known bool
+		for i := range passes {
+			known = known || passes[i].Name == n
+		}
+		if !known {
+			return nil, newError(ErrUnknownPass, "unknown pass %s", n)
+		}
+		names[n] = true
+	}
+
+	return names, nil
+}
+
+// spacingOperators are the operators the spaces pass removes the spaces
+// around.
+var spacingOperators = []string{
+	"=", "+", "-", "*", "/", "+=", "-=", "*=", "/=", "%=",
+	"-eq", "-ne", "-gt", "-ge", "-lt", "-le",
+	"(", ")", "[", "]", "{", "}", ";", ",",
+}
+
+// ParseSpacingOperators parses the comma separated list of operators into a
+// set, returning an error if any is not one of spacingOperators. Comparison
+// operators are matched ignoring case.
+func ParseSpacingOperators(list string) (map[string]bool, error) {
+	ops := make(map[string]bool)
+	for _, op := range strings.Split(list, ",") {
+		op = strings.ToLower(strings.TrimSpace(op))
+		if op == "" {
+			continue
+		}
+
+		var known bool
+		for i := range spacingOperators {
+			known = known || spacingOperators[i] == op
+		}
+		if !known {
+			return nil, newError(ErrUnknownOperator, "unknown operator %s", op)
+		}
+		ops[op] = true
+	}
+
+	return ops, nil
+}
+
+// ParseLineEnding returns the line ending named by name, lf or crlf.
+func ParseLineEnding(name string) (string, error) {
+	switch strings.ToLower(name) {
+	case "lf":
+		return "\n", nil
+	case "crlf":
+		return "\r\n", nil
+	}
+	return "", newError(ErrUnknownFormat, "unknown line ending %s", name)
+}
+
+// DataFileOptions returns opts limited to what is safe for the file at path.
+// A .psd1 data file, such as a module manifest, only allows a restricted
+// subset of the language so its variables are never renamed, every entry is
+// kept on its own line and no wrappers are added.
+func DataFileOptions(path string, opts Options) Options {
+	if !strings.EqualFold(filepath.Ext(path), ".psd1") {
+		return opts
+	}
+	opts.Log.logf(LogSummary, "%s is a data file, only comments and whitespace are removed", path)
+
+	disabled := map[string]bool{"variables": true}
+	for k, v := range opts.Disabled {
+		disabled[k] = v
+	}
+	opts.Disabled = disabled
+	opts.KeepNewlines = true
+	opts.KeepBlankLines = false
+	opts.KeepStructure = 0
+	opts.KeepPublicHelp = false
+	opts.OnlyFunctions = nil
+	opts.TargetBytes = 0
+	opts.Header, opts.Footer = "", ""
+
+	return opts
+}
+
+// Minimize minimizes lines as configured by opts.
+func Minimize(lines []string, opts Options) ([]string, error) {
+	// The first line is written as it is with the rest minimized as if the
+	// script started on the second. Its variables keep their names so they
+	// still match any use below. A first line leaving a comment, string or
+	// bracket open can not be split from the rest so is refused.
+	if opts.PreserveFirstLine && len(lines) > 0 {
+		var first lexState
+		first.scan(lines[0])
+		if first.comment || first.here != 0 || len(first.stack) > 0 {
+			return nil, newError(ErrFirstLineOpen, "%s: the first line leaves a comment, string or bracket open", ErrFirstLineOpen)
+		}
+		if first.unexpected != 0 && !opts.Force {
+			return nil, newError(ErrUnbalancedBraces, "input appears malformed: unexpected %c on line %d", first.unexpected, opts.lineOffset+1)
+		}
+
+		restOpts := opts
+		restOpts.PreserveFirstLine = false
+		restOpts.lineOffset++
+		extra := make(map[string]string)
+		for _, v := range getVariables(lines[:1], nil) {
+			extra[v.OriginalName] = ""
+		}
+		rest, err := Minimize(lines[1:], WithReserved(restOpts, extra))
+		if err != nil {
+			return nil, err
+		}
+		return append([]string{lines[0] + lineEnding(opts)}, rest...), nil
+	}
+
+	if opts.BlankLinesOnly {
+		return stripBlankLines(lines), nil
+	}
+	if opts.NormalizeEOL != "" {
+		return normalizeLineEndings(lines, opts.NormalizeEOL), nil
+	}
+
+	if !opts.Force {
+		if err := checkBalance(lines, opts.lineOffset); err != nil {
+			if !opts.AllowPartial {
+				return nil, err
+			}
+			return minimizePartial(lines, opts, err)
+		}
+	}
+
+	if len(opts.OnlyFunctions) > 0 {
+		return minimizeFunctions(lines, opts)
+	}
+	if opts.TargetBytes > 0 {
+		return minimizeToTarget(lines, opts, opts.TargetBytes)
+	}
+
+	return minimizeLines(lines, opts)
+}
+
+// minimizePartial minimizes the lines of a malformed script before the
+// problem reported by err and writes the rest as they are. The variables of
+// the rest keep their names so they still match any use above.
+func minimizePartial(lines []string, opts Options, err error) ([]string, error) {
+	n := balancedPrefix(lines)
+	warn(opts, "%s, lines %d to %d are left as is", err, opts.lineOffset+n+1, opts.lineOffset+len(lines))
+
+	extra := make(map[string]string)
+	for _, v := range getVariables(lines[n:], nil) {
+		extra[v.OriginalName] = ""
+	}
+
+	var head []string
+	if n > 0 {
+		var err error
+		head, err = Minimize(lines[:n], WithReserved(opts, extra))
+		if err != nil {
+			return nil, err
+		}
+		head = endLine(head, lineEnding(opts))
+	}
+	for _, l := range lines[n:] {
+		head = append(head, l+lineEnding(opts))
+	}
+
+	return head, nil
+}
+
+// minimizeLines runs every enabled pass over a copy of lines and returns the
+// minimized result.
+func minimizeLines(lines []string, opts Options) ([]string, error) {
+	minimizedLines := make([]string, len(lines), len(lines))
+	copy(minimizedLines, lines)
+
+	var help []string
+	if opts.KeepPublicHelp {
+		help = extractPublicHelp(minimizedLines)
+	}
+
+	ran := make(map[string]bool)
+	for i := range passes {
+		if opts.Disabled[passes[i].Name] {
+			continue
+		}
+
+		// Every pass is reported as complete once run even if it did not
+		// report all of the lines itself.
+		var report progressFunc
+		name, total := passes[i].Name, len(minimizedLines)
+		if opts.Progress != nil {
+			report = func(done int) { opts.Progress(name, done, total) }
+		}
+		var before []string
+		if opts.Log != nil || opts.AllowPartial {
+			before = make([]string, len(minimizedLines))
+			copy(before, minimizedLines)
+		}
+
+		var start time.Time
+		if opts.Timing != nil {
+			start = time.Now()
+		}
+
+		var err error
+		minimizedLines, err = passes[i].Run(minimizedLines, opts, report)
+		if opts.Timing != nil {
+			opts.Timing(name, time.Since(start))
+		}
+		if err != nil {
+			if !opts.AllowPartial {
+				return nil, err
+			}
+			warn(opts, "%s pass skipped: %s", name, err)
+			minimizedLines = before
+			continue
+		}
+		report.report(total)
+		ran[name] = true
+
+		if opts.Log != nil {
+			logPass(name, before, minimizedLines, opts.Log)
+		}
+	}
+
+	// Without the newlines pass the lines carry no separators of their own so
+	// one is added to keep them apart when written.
+	if !ran["newlines"] {
+		for i := range minimizedLines {
+			minimizedLines[i] += "\n"
+		}
+	}
+
+	return restoreHelp(minimizedLines, help), nil
+}
+
+// logPass logs the bytes a pass saved and, for passes that keep every line,
+// each line it changed.
+func logPass(name string, before []string, after []string, log LogFunc) {
+	log.logf(LogPasses, "%s: %d -> %d bytes, saved %d", name, GetLength(before), GetLength(after), GetLength(before)-GetLength(after))
+
+	if len(before) != len(after) {
+		return
+	}
+	for i := range before {
+		if before[i] != after[i] {
+			log.logf(LogLines, "%s: line %d %q => %q", name, i+1, before[i], after[i])
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package psminimize
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPreserveFirstLineErrorLine(t *testing.T) {
+	lines := []string{"#!/usr/bin/env pwsh", "$longname = 1", "}"}
+	_, err := Minimize(lines, Options{PreserveFirstLine: true})
+	if !errors.Is(err, ErrUnbalancedBraces) {
+		t.Fatalf("expected %q, got %v", ErrUnbalancedBraces, err)
+	}
+	if !strings.Contains(err.Error(), "line 3") {
+		t.Errorf("expected the error on line 3, got %q", err)
+	}
+}
+
+func TestDataFile(t *testing.T) {
+	path := filepath.Join("testdata", "manifest.psd1")
+	lines, _, err := ReadLines(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := os.ReadFile(filepath.Join("testdata", "manifest.min.psd1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := DataFileOptions(path, Options{Header: "# head", KeepStructure: 1})
+	minimized, err := Minimize(lines, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(FinishOutput(minimized, opts), ""); got != string(want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,81 @@
+package psminimize
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ProgressMinBytes is the size a script must be before progress is
+// reported. Anything smaller is minimized too quickly for it to be useful.
+const ProgressMinBytes = 1024 * 1024
+
+// progressFunc is called by a pass with the number of lines it has
+// processed so far.
+type progressFunc func(done int)
+
+// report calls f with done if f is set.
+func (f progressFunc) report(done int) {
+	if f != nil {
+		f(done)
+	}
+}
+
+// PrintProgress returns a function that prints the percentage of lines
+// each pass has processed to stderr, only printing when it changes.
+func PrintProgress() func(pass string, done int, total int) {
+	var lastPass string
+	var lastPercent int
+	return func(pass string, done int, total int) {
+		percent := 100
+		if total > 0 {
+			percent = done * 100 / total
+		}
+		if pass == lastPass && percent == lastPercent {
+			return
+		}
+		lastPass, lastPercent = pass, percent
+
+		fmt.Fprintf(os.Stderr, "\r%-10s %3d%%", pass, percent)
+		if percent == 100 {
+			fmt.Fprintln(os.Stderr)
+		}
+	}
+}
+
+// PassTimes adds up the time taken by each pass as reported to
+// Options.Timing. It is safe to use from scripts minimized at once.
+type PassTimes struct {
+	mu    sync.Mutex
+	names []string
+	times map[string]time.Duration
+}
+
+// Add adds elapsed to the time taken by pass.
+func (t *PassTimes) Add(pass string, elapsed time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.times == nil {
+		t.times = make(map[string]time.Duration)
+	}
+	if _, ok := t.times[pass]; !ok {
+		t.names = append(t.names, pass)
+	}
+	t.times[pass] += elapsed
+}
+
+// String returns the time taken by each pass in the order they first ran,
+// such as "comments: 12ms, variables: 340ms".
+func (t *PassTimes) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	parts := make([]string, len(t.names))
+	for i, name := range t.names {
+		parts[i] = fmt.Sprintf("%s: %s", name, t.times[name].Round(time.Microsecond))
+	}
+	return strings.Join(parts, ", ")
+}
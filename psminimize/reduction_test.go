@@ -0,0 +1,47 @@
+package psminimize
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// minCorpusReduction and maxCorpusReduction bound the percentage the scripts
+// of testdata/corpus are reduced by together, about 55% when added. Less than the minimum means a
+// pass stopped removing what it should, such as comments or whitespace,
+// while more than the maximum means something is likely being removed that
+// should not be. Changing the corpus shifts the figure so the band may need
+// to be moved along with it.
+const (
+	minCorpusReduction = 45.0
+	maxCorpusReduction = 65.0
+)
+
+func TestCorpusReduction(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "corpus", "*.ps1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatal("no scripts in testdata/corpus")
+	}
+
+	var original, minimized int
+	for _, path := range paths {
+		lines, length, err := ReadLines(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		output, err := Minimize(lines, Options{})
+		if err != nil {
+			t.Fatalf("%s: %s", path, err)
+		}
+		original += length
+		minimized += GetLength(output)
+	}
+
+	ratio := PercentReduced(original, minimized)
+	t.Logf("corpus reduced by %.1f%%", ratio)
+	if ratio < minCorpusReduction || ratio > maxCorpusReduction {
+		t.Errorf("corpus reduced by %.1f%%, expected %.0f%% to %.0f%%", ratio, minCorpusReduction, maxCorpusReduction)
+	}
+}
@@ -0,0 +1,110 @@
+package psminimize
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// reportTopVariables is the number of renamed variables listed in a report.
+const reportTopVariables = 20
+
+// Report gathers what happened while minimizing a script for a person to
+// review. Passes fill in the variables and warnings when Options.Report is
+// set and the rest is filled in by the caller.
+type Report struct {
+	Metrics
+
+	// Comments is the number of comments removed.
+	Comments int
+
+	// Variables holds every variable found, renamed or kept.
+	Variables PSVariables
+
+	// Warnings holds every warning raised, such as a pass skipped.
+	Warnings []string
+}
+
+// warn logs the warning and adds it to the report of opts if there is one.
+func warn(opts Options, format string, args ...interface{}) {
+	opts.Log.logf(LogSummary, "warning: "+format, args...)
+	if opts.Report != nil {
+		opts.Report.Warnings = append(opts.Report.Warnings, fmt.Sprintf(format, args...))
+	}
+}
+
+// WriteMarkdown writes r to w as a Markdown document. The most used renamed
+// variables are listed with their new names followed by every variable kept.
+func (r *Report) WriteMarkdown(w io.Writer) error {
+	renamed := make(PSVariables, 0, len(r.Variables))
+	var kept []string
+	for _, v := range r.Variables {
+		if v.Reserved {
+			kept = append(kept, v.OriginalName)
+		} else {
+			renamed = append(renamed, v)
+		}
+	}
+	sort.Stable(renamed)
+	sort.Strings(kept)
+
+	var b []byte
+	add := func(format string, args ...interface{}) {
+		b = append(b, fmt.Sprintf(format, args...)...)
+	}
+
+	add("# psminimize report\n\n")
+	add("|original bytes|minimized bytes|reduction|comments removed|duration|\n")
+	add("|----|----|----|----|----|\n")
+	add("|%d|%d|%.1f%%|%d|%.3fs|\n", r.OriginalBytes, r.MinimizedBytes, r.ReductionRatio()*100, r.Comments, r.Duration.Seconds())
+
+	add("\n## Renamed variables\n\n")
+	if len(renamed) == 0 {
+		add("None.\n")
+	} else {
+		if len(renamed) > reportTopVariables {
+			add("The %d most used of %d.\n\n", reportTopVariables, len(renamed))
+			renamed = renamed[:reportTopVariables]
+		}
+		add("|variable|new name|uses|\n|----|----|----|\n")
+		for _, v := range renamed {
+			add("|`%s`|`%s`|%d|\n", v.OriginalName, v.ShortName, v.Count)
+		}
+	}
+
+	add("\n## Kept variables\n\n")
+	if len(kept) == 0 {
+		add("None.\n")
+	}
+	for _, k := range kept {
+		add("* `%s`\n", k)
+	}
+
+	add("\n## Warnings\n\n")
+	if len(r.Warnings) == 0 {
+		add("None.\n")
+	}
+	for _, warning := range r.Warnings {
+		add("* %s\n", warning)
+	}
+
+	_, err := w.Write(b)
+	return err
+}
+
+// SaveMarkdown writes r as a Markdown document to the file at filePath.
+func (r *Report) SaveMarkdown(filePath string, log LogFunc) error {
+	log.logf(LogSummary, "saving report to: %s", filePath)
+
+	f, err := os.Create(filePath)
+	if err != nil {
+		return newError(ErrWrite, "%s: %s", ErrWrite, err)
+	}
+	defer f.Close()
+
+	if err := r.WriteMarkdown(f); err != nil {
+		return newError(ErrWrite, "%s: %s", ErrWrite, err)
+	}
+	return nil
+}
@@ -1,4 +1,11 @@
-package main
+package psminimize
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
 
 var reservedPSVariables = map[string]string{
 	"$$":                             "",
@@ -7,6 +14,7 @@ var reservedPSVariables = map[string]string{
 	"$_":                             "",
 	"$ARGS":                          "",
 	"$CONSOLEFILENAME":               "",
+	"$ENABLEDEXPERIMENTALFEATURES":   "",
 	"$ERROR":                         "",
 	"$EVENT":                         "",
 	"$EVENTARGS":                     "",
@@ -17,6 +25,10 @@ var reservedPSVariables = map[string]string{
 	"$HOME":                          "",
 	"$HOST":                          "",
 	"$INPUT":                         "",
+	"$ISCORECLR":                     "",
+	"$ISLINUX":                       "",
+	"$ISMACOS":                       "",
+	"$ISWINDOWS":                     "",
 	"$LASTEXITCODE":                  "",
 	"$MATCHES":                       "",
 	"$MYINVOCATION":                  "",
@@ -29,12 +41,14 @@ var reservedPSVariables = map[string]string{
 	"$PSCOMMANDPATH":                 "",
 	"$PSCULTURE":                     "",
 	"$PSDEBUGCONTEXT":                "",
+	"$PSEDITION":                     "",
 	"$PSHOME":                        "",
 	"$PSITEM":                        "",
 	"$PSSCRIPTROOT":                  "",
 	"$PSSENDERINFO":                  "",
 	"$PSUICULTURE":                   "",
 	"$PSVERSIONTABLE":                "",
+	"$PWD":                           "",
 	"$REPORTERRORSHOWEXCEPTIONCLASS": "",
 	"$REPORTERRORSHOWINNEREXCEPTION": "",
 	"$REPORTERRORSHOWSOURCE":         "",
@@ -42,6 +56,7 @@ var reservedPSVariables = map[string]string{
 	"$SENDER":                        "",
 	"$SHELLID":                       "",
 	"$STACKTRACE":                    "",
+	"$SWITCH":                        "",
 	"$THIS":                          "",
 	"$TRUE":                          "",
 	"$CONFIRMPREFERENCE":             "",
@@ -71,7 +86,58 @@ var reservedPSVariables = map[string]string{
 	"$PSSESSIONAPPLICATIONNAME":      "",
 	"$PSSESSIONCONFIGURATIONNAME":    "",
 	"$PSSESSIONOPTION":               "",
+	"$PSSTYLE":                       "",
+	"$TRANSCRIPT":                    "",
 	"$VERBOSEPREFERENCE":             "",
 	"$WARNINGPREFERENCE":             "",
 	"$WHATIFPREFERENCE":              "",
+
+	"$PSNATIVECOMMANDARGUMENTPASSING":          "",
+	"$PSNATIVECOMMANDUSEERRORACTIONPREFERENCE": "",
+}
+
+// ListReserved writes every built in reserved variable to w, one per line in
+// sorted order.
+func ListReserved(w io.Writer) {
+	var names []string
+	for k := range reservedPSVariables {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	for _, n := range names {
+		fmt.Fprintln(w, n)
+	}
+}
+
+// matchReservedNames returns the keys of the variables of lines named in
+// names, each given with or without its $. A name matches the variable
+// whatever its case unless caseSensitive is set, when lines must spell it
+// exactly so at least once.
+func matchReservedNames(lines []string, names []string, caseSensitive bool) map[string]string {
+	matched := make(map[string]string)
+	exact := make(map[string]bool)
+	for _, n := range names {
+		n = "$" + strings.TrimPrefix(strings.TrimSpace(n), "$")
+		if caseSensitive {
+			exact[n] = true
+		} else {
+			matched[strings.ToUpper(n)] = ""
+		}
+	}
+	if len(exact) == 0 {
+		return matched
+	}
+
+	vars := findScriptVariables(lines)
+	splats := findScriptSplats(lines)
+	for i := range lines {
+		for _, v := range append(vars[i], splats[i]...) {
+			if exact["$"+lines[i][v.NameStart:v.NameEnd]] {
+				matched[v.Key] = ""
+			}
+		}
+	}
+
+	return matched
 }
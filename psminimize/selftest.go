@@ -0,0 +1,339 @@
+package psminimize
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// selfTest is a script minimized by the self test along with the output, or
+// the error, expected from it.
+type selfTest struct {
+	Name   string
+	Script string
+	Opts   Options
+	Want   string
+	Err    error
+}
+
+// selfTests are the scripts run by the self test. Each covers one of the
+// passes or a rule the output depends on to keep working. Variables are used
+// a different number of times so the names they are given never change.
+var selfTests = []selfTest{
+	{
+		Name:   "comments",
+		Script: "# line comment\nWrite-Host 'a' # trailing\n<# block\ncomment #>\nWrite-Host 'b'",
+		Want:   "Write-Host 'a';Write-Host 'b';",
+	},
+	{
+		Name:   "variables",
+		Script: "$first = 1\n$second = $first + $first\n$second",
+		Want:   "$B=1;$A=$B+$B;$A;",
+	},
+	{
+		Name:   "reserved variables",
+		Script: "$items | ForEach-Object { $_ }\n$items = $true",
+		Want:   "$A | ForEach-Object{$_};$A=$true;",
+	},
+	{
+		Name:   "reserved prefix",
+		Script: "$host2 = $host.Name\nWrite-Host $host2 $host",
+		Want:   "$A=$host.Name;Write-Host $A $host;",
+	},
+	{
+		Name:   "automatic variables",
+		Script: "$_ | Where-Object { $_ -gt 0 }\n$PSItem, $args, $input, $this, $null, $true, $false, $MyInvocation",
+		Want:   "$_ | Where-Object{$_-gt 0};$PSItem,$args,$input,$this,$null,$true,$false,$MyInvocation;",
+	},
+	{
+		Name:   "special variables",
+		Script: "if ($?) { $x }\n$x = $$, $^\nWrite-Host $x",
+		Want:   "if($?){$A};$A=$$,$^;Write-Host $A;",
+	},
+	{
+		Name:   "named arguments",
+		Script: "function Get-It {\n  param($Path)\n  $Path\n}\nGet-It -Path 'c:\\'",
+		Want:   "function Get-It{param($Path);$Path};Get-It -Path 'c:\\';",
+	},
+	{
+		Name:   "tied variables",
+		Script: "$y = 1\n$x = 2\n$w = $y + $x + $w",
+		Want:   "$C=1;$B=2;$A=$C+$B+$A;",
+	},
+	{
+		Name:   "min count",
+		Script: "$rare = 1\n$often = $rare\n$often + $often",
+		Opts:   Options{MinVarCount: 3},
+		Want:   "$rare=1;$A=$rare;$A+$A;",
+	},
+	{
+		Name:   "kept short name",
+		Script: "function f { param($a) $a }\nf -a 1\n$other = 2\n$other",
+		Want:   "function f{param($a)$a};f -a 1;$B=2;$B;",
+	},
+	{
+		Name:   "variables by name",
+		Script: "Set-Variable -Name 'count' -Value 1\nNew-Variable total 2\n$count + $total + $other",
+		Want:   "Set-Variable -Name 'count' -Value 1;New-Variable total 2;$count+$total+$A;",
+	},
+	{
+		Name:   "attributes",
+		Script: "function Get-It {\n  [CmdletBinding()]\n  [OutputType([string])]\n  param([string]$Path)\n  $Path\n}\nGet-It -Path x",
+		Want:   "function Get-It{[CmdletBinding()][OutputType([string])]param([string]$Path);$Path};Get-It -Path x;",
+	},
+	{
+		Name:   "scopes",
+		Script: "$global:count = 1\n$count + $script:count\n$env:PATH\n$variable:kept + $kept",
+		Want:   "$global:A=1;$A+$script:A;$env:PATH;$variable:kept+$kept;",
+	},
+	{
+		Name:   "param comments",
+		Script: "param(\n  [Parameter()] # the path (required\n  [string] $Path, # don't ' quote\n  [int] $Count <# ) #>\n)\n$Path * $Count + $Path",
+		Want:   "param([Parameter()] [string]$B,[int]$A);$B*$A+$B;",
+	},
+	{
+		Name:   "strings",
+		Script: "$url = \"http://host/#a  b\"\nWrite-Host 'it''s  #kept'",
+		Want:   "$A=\"http://host/#a  b\";Write-Host 'it''s  #kept';",
+	},
+	{
+		Name:   "operators in strings",
+		Script: "$msg = \"a = b ( x ) `\" c + d\"\nWrite-Host 'x -eq  y , z' $msg",
+		Want:   "$A=\"a = b ( x ) `\" c + d\";Write-Host 'x -eq  y , z' $A;",
+	},
+	{
+		Name:   "nested strings",
+		Script: "$fmt = 'yyyy'\n\"$(Get-Date -Format 'yyyy = MM' ) and $( $fmt + \"a ( b\" )\"",
+		Want:   "$A='yyyy';\"$(Get-Date -Format 'yyyy = MM') and $($A+\"a ( b\")\";",
+	},
+	{
+		Name:   "splats in strings",
+		Script: "$x = @{ a = 1 }\nf @x\nWrite-Host 'mail me @x' \"see @x\"\n@'\n@x is text\n'@",
+		Want:   "$A=@{a=1};f @A;Write-Host 'mail me @x' \"see @x\";@'\n@x is text\n'@;",
+	},
+	{
+		Name:   "interpolation",
+		Script: "$x = 1\n\"a$x b\"\n\"${x}y\"\n'$x'\n@'\n$x\n'@\n\"it's $x\"",
+		Want:   "$A=1;\"a$A b\";\"${A}y\";'$x';@'\n$x\n'@;\"it's $A\";",
+	},
+	{
+		Name:   "here-strings",
+		Script: "$text = @\"\n  # not a comment\n\"@\n$text",
+		Want:   "$A=@\"\n  # not a comment\n\"@;$A;",
+	},
+	{
+		Name:   "string data",
+		Script: "$msgs = ConvertFrom-StringData @'\n  greeting = Hello ( world )\n\n  farewell   =   Bye, now\n'@\n$msgs.greeting",
+		Want:   "$A=ConvertFrom-StringData @'\n  greeting = Hello ( world )\n\n  farewell   =   Bye, now\n'@;$A.greeting;",
+	},
+	{
+		Name:   "try catch",
+		Script: "try {\n  Get-Item x\n}\ncatch [System.IO.IOException]\n{\n  'io'\n}\nfinally {\n  'done'\n}",
+		Want:   "try{Get-Item x}catch[System.IO.IOException]\n{'io'}finally{'done'};",
+	},
+	{
+		Name:   "operator continuation",
+		Script: "$ok = $first -eq 1 -and\n  $first -lt 3\nif ($ok -or\n    $ok) { 1 }",
+		Want:   "$B=$A-eq 1 -and $A-lt 3;if($B -or $B){1};",
+	},
+	{
+		Name:   "minus",
+		Script: "$a = $b - $c\nls -Force",
+		Opts:   Options{Disabled: map[string]bool{"variables": true}},
+		Want:   "$a=$b - $c;ls -Force;",
+	},
+	{
+		Name:   "backtick continuation",
+		Script: "Get-ChildItem -Path $root `\n    -Recurse `\n    -Filter '*.ps1'\n$root",
+		Want:   "Get-ChildItem -Path $A -Recurse -Filter '*.ps1';$A;",
+	},
+	{
+		Name:   "pipe continuation",
+		Script: "Get-Process |\n  Where-Object { $_.CPU } |\n  Select-Object -First 1\n$list = 1,\n  2\n$list",
+		Want:   "Get-Process |Where-Object{$_.CPU}|Select-Object -First 1;$A=1,2;$A;",
+	},
+	{
+		Name:   "param keyword",
+		Script: "Param\n($a)\nparam (\n$b\n)\n$item\n$item",
+		Opts:   Options{Disabled: map[string]bool{"variables": true}},
+		Want:   "Param($a);param($b);$item;$item;",
+	},
+	{
+		Name:   "shared function variables",
+		Script: "function A {\n  $script:counter = 1\n  $own = 2\n}\nfunction B {\n  $script:counter\n  $mine = 3\n}",
+		Opts:   Options{OnlyFunctions: []string{"A", "B"}},
+		Want:   "function A{$script:counter=1;$A=2};\nfunction B{$script:counter;$A=3};\n",
+	},
+	{
+		Name:   "reserved names",
+		Script: "$Path = 'a'\nWrite-Host $path $other",
+		Opts:   Options{ReservedNames: []string{"$PATH"}},
+		Want:   "$Path='a';Write-Host $path $A;",
+	},
+	{
+		Name:   "reserved names case-sensitive",
+		Script: "$Path = 'a'\nWrite-Host $path $other",
+		Opts:   Options{ReservedNames: []string{"$PATH", "other"}, ReservedCaseSensitive: true},
+		Want:   "$A='a';Write-Host $A $other;",
+	},
+	{
+		Name:   "reserved names case-sensitive match",
+		Script: "$Path = 'a'\nWrite-Host $path $other",
+		Opts:   Options{ReservedNames: []string{"$path"}, ReservedCaseSensitive: true},
+		Want:   "$Path='a';Write-Host $path $A;",
+	},
+	{
+		Name:   "prefix names",
+		Script: "$a = 1\n$abc = 2\n$animal = 3\nWrite-Host \"$abc ${abc} $a$animal\"\n$abc + $a + $animal + $abc",
+		Want:   "$D=1;$C=2;$B=3;Write-Host \"$C ${C} $D$B\";$C+$D+$B+$C;",
+	},
+	{
+		Name:   "comments kept",
+		Script: "$first = 1 # note\n<# block #> $second = 2\n# whole line\n$first + $second",
+		Opts:   Options{Disabled: map[string]bool{"comments": true}},
+		Want:   "$B=1 # note\n<# block #> $A=2;# whole line\n$B+$A;",
+	},
+	{
+		Name:   "first line crlf",
+		Script: "#!/usr/bin/env pwsh\n$first = 1\nWrite-Host $first",
+		Opts:   Options{PreserveFirstLine: true, KeepNewlines: true, LineEnding: "\r\n"},
+		Want:   "#!/usr/bin/env pwsh\r\n$A=1\r\nWrite-Host $A\r\n",
+	},
+	{
+		Name:   "functions keep newlines",
+		Script: "function A {\n  $inner = 2\n}\n$outer = 1",
+		Opts:   Options{OnlyFunctions: []string{"A"}, KeepNewlines: true, LineEnding: "\r\n"},
+		Want:   "function A{\r\n$A=2\r\n}\r\n$outer = 1\r\n",
+	},
+	{
+		Name:   "no rename",
+		Script: "$first = 1 # one\n$second = $first",
+		Opts:   Options{Disabled: map[string]bool{"variables": true}},
+		Want:   "$first=1;$second=$first;",
+	},
+	{
+		Name:   "stop parsing",
+		Script: "icacls.exe C:\\x --% /grant  Users:(F)\nWrite-Host 'next'",
+		Want:   "icacls.exe C:\\x --% /grant  Users:(F)\nWrite-Host 'next';",
+	},
+	{
+		Name:   "keep newlines",
+		Script: "if ($a -eq 1) {\n    Write-Host 'one'\n}",
+		Opts:   Options{KeepNewlines: true},
+		Want:   "if($B-eq 1){\nWrite-Host 'one'\n}\n",
+	},
+	{
+		Name:   "preserve crlf",
+		Script: "if ($a) {\r\n  'x'\r\n}",
+		Opts:   Options{PreserveNewlines: true, LineEnding: "\r\n"},
+		Want:   "if($B){\r\n'x'\r\n}\r\n",
+	},
+	{
+		Name:   "preserve lf",
+		Script: "if ($a) {\n  'x'\n}",
+		Opts:   Options{PreserveNewlines: true, LineEnding: "\n"},
+		Want:   "if($B){\n'x'\n}\n",
+	},
+	{
+		Name:   "reindent",
+		Script: "function f {\nforeach ($item in @(\n1, 2\n)) {\n        # each\n    $item\n}\n}",
+		Opts:   Options{Reindent: true},
+		Want:   "function f{\n  foreach($A in @(\n      1,2\n  )){\n    $A\n  }\n}\n",
+	},
+	{
+		Name:   "first line open",
+		Script: "<# header\n$longname = 1 #>\n$longname",
+		Opts:   Options{PreserveFirstLine: true},
+		Err:    ErrFirstLineOpen,
+	},
+	{
+		Name:   "first line brace",
+		Script: "function f {\n  $longname = 1\n}",
+		Opts:   Options{PreserveFirstLine: true},
+		Err:    ErrFirstLineOpen,
+	},
+	{
+		Name:   "unterminated string",
+		Script: "Write-Host 'a\n$b = 1",
+		Err:    ErrUnterminatedString,
+	},
+	{
+		Name:   "unterminated nested string",
+		Script: "if ($a) {\n  Write-Host 'oops\n}",
+		Err:    ErrUnterminatedString,
+	},
+	{
+		Name:   "unterminated here-string",
+		Script: "$text = @'\n  text",
+		Err:    ErrUnterminatedString,
+	},
+	{
+		Name:   "malformed",
+		Script: "if ($a) {\n  Write-Host 'a'",
+		Err:    ErrMalformedInput,
+	},
+}
+
+// selfTestShortNames is the number of short names the self test checks are
+// unique and valid.
+const selfTestShortNames = 5000
+
+// RunSelfTest minimizes every script of selfTests writing whether each
+// passed to w, followed by whether the short names generated are unique and
+// valid. It returns false if any failed.
+func RunSelfTest(w io.Writer) bool {
+	passed := true
+	for _, t := range selfTests {
+		if err := t.check(); err != nil {
+			fmt.Fprintf(w, "FAIL %s: %s\n", t.Name, err)
+			passed = false
+		} else {
+			fmt.Fprintf(w, "ok   %s\n", t.Name)
+		}
+	}
+
+	if err := checkShortNameSequence(selfTestShortNames); err != nil {
+		fmt.Fprintf(w, "FAIL short names: %s\n", err)
+		passed = false
+	} else {
+		fmt.Fprintf(w, "ok   short names\n")
+	}
+
+	return passed
+}
+
+// check minimizes the script of t returning an error describing how the
+// result differs from what is expected, if it does.
+func (t selfTest) check() error {
+	lines, err := Minimize(strings.Split(t.Script, "\n"), t.Opts)
+	got := strings.Join(lines, "")
+
+	switch {
+	case t.Err != nil && !errors.Is(err, t.Err):
+		return fmt.Errorf("expected error %q, got %v", t.Err, err)
+	case t.Err == nil && err != nil:
+		return err
+	case t.Err == nil && got != t.Want:
+		return fmt.Errorf("\n  expected %q\n  got      %q", t.Want, got)
+	}
+
+	return nil
+}
+
+// checkShortNameSequence returns an error if any of the first n short names
+// is repeated, ignoring case, or is not a valid variable name.
+func checkShortNameSequence(n int) error {
+	seen := make(map[string]int, n)
+	for i := 0; i < n; i++ {
+		name := shortName(i)
+		if !psNameReg.MatchString(name) {
+			return fmt.Errorf("name %d %q is not a valid variable name", i, name)
+		}
+		if j, ok := seen[strings.ToUpper(name)]; ok {
+			return fmt.Errorf("names %d and %d are both %q", j, i, name)
+		}
+		seen[strings.ToUpper(name)] = i
+	}
+	return nil
+}
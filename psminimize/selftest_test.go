@@ -0,0 +1,20 @@
+package psminimize
+
+import "testing"
+
+func TestSelfTest(t *testing.T) {
+	for _, st := range selfTests {
+		st := st
+		t.Run(st.Name, func(t *testing.T) {
+			if err := st.check(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestShortNameSequence(t *testing.T) {
+	if err := checkShortNameSequence(selfTestShortNames); err != nil {
+		t.Error(err)
+	}
+}
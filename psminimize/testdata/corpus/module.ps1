@@ -0,0 +1,41 @@
+function Get-Inventory {
+    <#
+    .SYNOPSIS
+      Lists the items of a folder with their sizes.
+    .PARAMETER FolderPath
+      The folder to list.
+    #>
+    param(
+        [Parameter(Mandatory = $true)]
+        [string]$FolderPath,
+        [switch]$IncludeHidden
+    )
+
+    $inventoryItems = @()
+    foreach ($currentItem in Get-ChildItem -Path $FolderPath -Force:$IncludeHidden) {
+        # Folders have no length of their own.
+        if ($currentItem.PSIsContainer) {
+            continue
+        }
+
+        $inventoryItems += [PSCustomObject]@{
+            Name   = $currentItem.Name
+            Length = $currentItem.Length
+        }
+    }
+
+    return $inventoryItems
+}
+
+function Format-Inventory {
+    param($inventoryItems)
+
+    $totalLength = 0
+    foreach ($inventoryItem in $inventoryItems) {
+        $totalLength += $inventoryItem.Length
+        Write-Output ("{0,-40} {1,10}" -f $inventoryItem.Name, $inventoryItem.Length)
+    }
+    Write-Output "Total: $totalLength bytes"
+}
+
+Export-ModuleMember -Function Get-Inventory, Format-Inventory
@@ -0,0 +1,23 @@
+# Runs a command until it succeeds or runs out of attempts.
+$maximumAttempts = 5
+$delaySeconds = 2
+$attemptNumber = 0
+$lastError = $null
+
+while ($attemptNumber -lt $maximumAttempts) {
+    $attemptNumber++
+    try {
+        $response = Invoke-WebRequest -Uri 'https://example.com/status' -UseBasicParsing
+        Write-Host "Attempt $attemptNumber succeeded with $($response.StatusCode)"
+        break
+    }
+    catch {
+        $lastError = $_
+        Write-Warning "Attempt $attemptNumber failed: $lastError"
+        Start-Sleep -Seconds ($delaySeconds * $attemptNumber)
+    }
+}
+
+if ($attemptNumber -ge $maximumAttempts) {
+    throw $lastError
+}
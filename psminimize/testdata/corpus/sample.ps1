@@ -0,0 +1,31 @@
+<#
+.SYNOPSIS
+  Sample script used to exercise psminimize.
+#>
+param(
+    [string]$InputPath,
+    [int]$RetryCount = 3
+)
+
+$script:counter = 0
+$longVariableName = "Hello World"
+
+function Get-Big {
+    param($itemCount)
+    # build a list
+    $results = @()
+    for ($index = 0; $index -lt $itemCount; $index++) {
+        $results += $index * 2
+    }
+    return $results
+}
+
+function Set-Huge {
+    param($value)
+    $message = "Value is $value"
+    Write-Host $message
+}
+
+$items = Get-Big -itemCount 10
+Set-Huge -value $longVariableName
+Write-Host "done" # trailing
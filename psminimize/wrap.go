@@ -0,0 +1,123 @@
+package psminimize
+
+import (
+	"os"
+	"strings"
+)
+
+// LoadWrapper returns the content to wrap the output with from value. If
+// value is the path of a file the file is read, otherwise value is used as
+// is. When minify is set the content is minimized without renaming
+// variables as they share a scope with the script they wrap.
+func LoadWrapper(value string, minify bool) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+
+	lines, _, err := ReadLines(value)
+	if os.IsNotExist(err) {
+		lines, err = strings.Split(value, "\n"), nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if !minify {
+		return strings.Join(lines, "\n"), nil
+	}
+
+	lines, err = Minimize(lines, Options{Disabled: map[string]bool{"variables": true}})
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(strings.Join(lines, "")), nil
+}
+
+// wrapLines returns lines with header and footer added on lines of their
+// own before and after them, each new line written as eol.
+func wrapLines(lines []string, header string, footer string, eol string) []string {
+	if header == "" && footer == "" {
+		return lines
+	}
+
+	wrapped := make([]string, 0, len(lines)+2)
+	if header != "" {
+		wrapped = append(wrapped, strings.Replace(header, "\n", eol, -1)+eol)
+	}
+	wrapped = append(wrapped, lines...)
+	if footer != "" {
+		wrapped = append(endLine(wrapped, eol), strings.Replace(footer, "\n", eol, -1))
+	}
+
+	return wrapped
+}
+
+// GuardGrowth returns minimized unless it is larger than the original lines
+// as they were read, in which case a warning is raised and, with opts.NoGrow
+// set, the original lines are returned to be written instead. Rewriting only
+// the line endings is expected to change the size so is never warned of.
+func GuardGrowth(lines []string, minimized []string, opts Options) []string {
+	if opts.NormalizeEOL != "" {
+		return minimized
+	}
+
+	original := normalizeLineEndings(lines, lineEnding(opts))
+	if GetLength(minimized) <= GetLength(original) {
+		return minimized
+	}
+
+	warn(opts, "minified output is LARGER than the input, %d > %d bytes", GetLength(minimized), GetLength(original))
+	if !opts.NoGrow {
+		return minimized
+	}
+	opts.Log.logf(LogSummary, "writing the original script instead")
+	return original
+}
+
+// FinishOutput returns lines as they are written out, wrapped with the
+// header and footer of opts and ending in exactly one new line unless
+// opts.NoFinalNewline is set, written as opts.LineEnding if set. With
+// opts.NormalizeEOL set it always ends in that line ending. A script left
+// with nothing, such as one that only held comments, is written out empty
+// either way.
+func FinishOutput(lines []string, opts Options) []string {
+	output := make([]string, 0, len(lines)+3)
+	output = append(output, wrapLines(lines, opts.Header, opts.Footer, lineEnding(opts))...)
+
+	for len(output) > 0 {
+		last := strings.TrimRight(output[len(output)-1], "\r\n")
+		if last != "" {
+			output[len(output)-1] = last
+			break
+		}
+		output = output[:len(output)-1]
+	}
+
+	if len(output) > 0 && (!opts.NoFinalNewline || opts.NormalizeEOL != "") {
+		output = append(output, lineEnding(opts))
+	}
+
+	return output
+}
+
+// lineEnding returns the line ending written for opts, that of NormalizeEOL
+// or LineEnding when set or \n otherwise.
+func lineEnding(opts Options) string {
+	switch {
+	case opts.NormalizeEOL != "":
+		return opts.NormalizeEOL
+	case opts.LineEnding != "":
+		return opts.LineEnding
+	}
+	return "\n"
+}
+
+// endLine returns lines with eol added after the last unless it already
+// ends in a new line.
+func endLine(lines []string, eol string) []string {
+	if len(lines) > 0 && strings.HasSuffix(lines[len(lines)-1], "\n") {
+		return lines
+	}
+	return append(lines, eol)
+}
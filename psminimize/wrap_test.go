@@ -0,0 +1,71 @@
+package psminimize
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFinishOutput(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		opts  Options
+		want  string
+	}{
+		{"final new line", []string{"$A=1;"}, Options{}, "$A=1;\n"},
+		{"one final new line", []string{"$A=1\n", "\n", "\n"}, Options{}, "$A=1\n"},
+		{"no final new line", []string{"$A=1\n"}, Options{NoFinalNewline: true}, "$A=1"},
+		{"crlf", []string{"$A=1\r\n"}, Options{LineEnding: "\r\n"}, "$A=1\r\n"},
+		{"wrapped", []string{"$A=1;"}, Options{Header: "# head", Footer: "# foot"}, "# head\n$A=1;\n# foot\n"},
+		{"wrapped kept lines", []string{"$A=1\n"}, Options{Header: "# head", Footer: "# foot"}, "# head\n$A=1\n# foot\n"},
+		{"wrapped crlf", []string{"$A=1\r\n"}, Options{Header: "# a\n# b", Footer: "# foot", LineEnding: "\r\n"}, "# a\r\n# b\r\n$A=1\r\n# foot\r\n"},
+		{"empty", []string{"\n"}, Options{}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := strings.Join(FinishOutput(tt.lines, tt.opts), "")
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFinalByte(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+		want byte
+	}{
+		{"final new line", Options{}, '\n'},
+		{"no final new line", Options{NoFinalNewline: true}, ';'},
+		{"kept lines", Options{KeepNewlines: true, NoFinalNewline: true}, 'A'},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines, err := Minimize([]string{"$x = 1", "$x"}, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join(t.TempDir(), "out.ps1")
+			if err := SaveToFile(FinishOutput(lines, tt.opts), path, nil); err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(data) == 0 || data[len(data)-1] != tt.want {
+				t.Errorf("got %q, want it to end in %q", data, tt.want)
+			}
+			if bytes.HasSuffix(data, []byte("\n\n")) {
+				t.Errorf("got %q, want at most one final new line", data)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package psminimize
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"os"
+)
+
+// MinimizeZip minimizes every script within the zip archive at inPath into a
+// new archive at outPath, keeping every entry at the same path. Entries that
+// are not scripts, match one of exclude or fail to minimize are copied as
+// they are so the new archive is always complete, with each failure logged
+// and counted in the error returned.
+func MinimizeZip(inPath string, outPath string, opts Options, exclude []string) error {
+	r, err := zip.OpenReader(inPath)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	f, err := os.Create(outPath)
+	if err != nil {
+		return newError(ErrWrite, "%s: %s", ErrWrite, err)
+	}
+	defer f.Close()
+
+	w := zip.NewWriter(f)
+	opts.Progress = nil
+
+	var total, failed int
+	var originalLength, minimizedLength int
+	for _, entry := range r.File {
+		if entry.FileInfo().IsDir() || !isScript(entry.Name) || excluded(exclude, entry.Name) {
+			if err := w.Copy(entry); err != nil {
+				return newError(ErrWrite, "%s: %s", ErrWrite, err)
+			}
+			continue
+		}
+
+		total++
+		output, length, err := minimizeZipEntry(entry, opts)
+		if err != nil {
+			failed++
+			opts.Log.logf(LogSummary, "%s: %s", entry.Name, err)
+			if err := w.Copy(entry); err != nil {
+				return newError(ErrWrite, "%s: %s", ErrWrite, err)
+			}
+			continue
+		}
+
+		header := entry.FileHeader
+		ew, err := w.CreateHeader(&header)
+		if err != nil {
+			return newError(ErrWrite, "%s: %s", ErrWrite, err)
+		}
+		if err := writeLines(ew, output); err != nil {
+			return err
+		}
+		originalLength += length
+		minimizedLength += GetLength(output)
+	}
+
+	if err := w.Close(); err != nil {
+		return newError(ErrWrite, "%s: %s", ErrWrite, err)
+	}
+
+	opts.Log.logf(LogSummary, "minimized %d of %d scripts reducing them by %f%%", total-failed, total, PercentReduced(originalLength, minimizedLength))
+	if failed > 0 {
+		return newError(ErrScriptsFailed, "%d %s", failed, ErrScriptsFailed)
+	}
+
+	return nil
+}
+
+// minimizeZipEntry minimizes the script held by entry returning the output
+// as it is written and the bytes read.
+func minimizeZipEntry(entry *zip.File, opts Options) ([]string, int, error) {
+	rc, err := entry.Open()
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, 0, err
+	}
+	lines, err := ReadLinesFrom(bytes.NewReader(data))
+	if err != nil {
+		return nil, 0, err
+	}
+	opts = DataFileOptions(entry.Name, opts)
+	if opts.PreserveNewlines {
+		opts.LineEnding = DetectLineEnding(data)
+	}
+
+	minimized, err := Minimize(lines, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return FinishOutput(GuardGrowth(lines, minimized, opts), opts), len(data), nil
+}
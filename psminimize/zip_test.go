@@ -0,0 +1,101 @@
+package psminimize
+
+import (
+	"archive/zip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// zipEntry is a file held by a zip archive.
+type zipEntry struct {
+	Name string
+	Data string
+}
+
+// writeZip writes an archive at path holding entries in order.
+func writeZip(t *testing.T, path string, entries []zipEntry) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	w := zip.NewWriter(f)
+	for _, e := range entries {
+		ew, err := w.Create(e.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(ew, e.Data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readZip returns the entries of the archive at path in order.
+func readZip(t *testing.T, path string) []zipEntry {
+	t.Helper()
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	var entries []zipEntry
+	for _, f := range r.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, zipEntry{f.Name, string(data)})
+	}
+	return entries
+}
+
+func TestMinimizeZip(t *testing.T) {
+	dir := t.TempDir()
+	inPath, outPath := filepath.Join(dir, "module.zip"), filepath.Join(dir, "module.min.zip")
+	writeZip(t, inPath, []zipEntry{
+		{"Sample/", ""},
+		{"Sample/Sample.psm1", "function Get-Sample {\n  # the value\n  $value = 1\n  $value + $value\n}\n"},
+		{"Sample/Sample.psd1", "@{\n  # the module\n  RootModule = 'Sample.psm1'\n}\n"},
+		{"Sample/README.md", "# Sample\n\n$value = 1\n"},
+		{"Sample/Private/skip.ps1", "$value = 1\n$value\n"},
+		{"Sample/Private/broken.ps1", "$value = {\n"},
+	})
+
+	err := MinimizeZip(inPath, outPath, Options{}, []string{"skip.ps1"})
+	if !errors.Is(err, ErrScriptsFailed) {
+		t.Fatalf("expected %q, got %v", ErrScriptsFailed, err)
+	}
+
+	want := []zipEntry{
+		{"Sample/", ""},
+		{"Sample/Sample.psm1", "function Get-Sample{$A=1;$A+$A};\n"},
+		{"Sample/Sample.psd1", "@{\nRootModule='Sample.psm1'\n}\n"},
+		{"Sample/README.md", "# Sample\n\n$value = 1\n"},
+		{"Sample/Private/skip.ps1", "$value = 1\n$value\n"},
+		{"Sample/Private/broken.ps1", "$value = {\n"},
+	}
+	got := readZip(t, outPath)
+	if len(got) != len(want) {
+		t.Fatalf("got %d entries, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("entry %d: got %q, want %q", i, got[i], want[i])
+		}
+	}
+}